@@ -0,0 +1,125 @@
+// Command golib-migrate runs versioned sql migrations of a directory against the write database,
+// the connection is read from DBW_* environment variables or the -url flag
+//
+//	golib-migrate -dir ./migrations up
+//	golib-migrate -dir ./migrations down [steps]
+//	golib-migrate -dir ./migrations goto <version>
+//	golib-migrate -dir ./migrations status
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Bhinneka/golib"
+	"github.com/Bhinneka/golib/migrate"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+)
+
+func main() {
+	err := run()
+	if err != nil {
+		golib.LogError(err, "migrate", "run")
+	}
+	// queued log entries are written before exiting
+	golib.CloseLogs()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "golib-migrate:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	dir := flag.String("dir", "migrations", "directory of migration files")
+	table := flag.String("table", migrate.DefaultTable, "table recording applied versions")
+	url := flag.String("url", "", "database url, DBW_* environment variables are used when empty")
+	timeout := flag.Duration("timeout", 10*time.Minute, "deadline of the whole run")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: golib-migrate [flags] up | down [steps] | goto <version> | status")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return fmt.Errorf("missing command")
+	}
+
+	cfg, err := golib.DBConfigFromEnv("DBW")
+	if *url != "" {
+		cfg, err = golib.DBConfigFromURL(*url)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	db, err := golib.NewDBConnection(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := migrate.New(db.DB(), migrate.Config{Dir: *dir, Table: *table, Dialect: cfg.Dialect})
+	if err != nil {
+		return err
+	}
+
+	var done []migrate.Migration
+	switch cmd := flag.Arg(0); cmd {
+	case "up":
+		done, err = m.Up(ctx)
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			if steps, err = strconv.Atoi(flag.Arg(1)); err != nil {
+				return fmt.Errorf("invalid steps: %v", err)
+			}
+		}
+		done, err = m.Down(ctx, steps)
+	case "goto":
+		if flag.NArg() < 2 {
+			return fmt.Errorf("missing version")
+		}
+		version, perr := strconv.ParseUint(flag.Arg(1), 10, 64)
+		if perr != nil {
+			return fmt.Errorf("invalid version: %v", perr)
+		}
+		done, err = m.Goto(ctx, version)
+	case "status":
+		return printStatus(ctx, m)
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+
+	for _, mg := range done {
+		fmt.Printf("%d_%s\n", mg.Version, mg.Name)
+	}
+	if err == migrate.ErrNoChange {
+		fmt.Println("no change")
+		return nil
+	}
+	return err
+}
+
+func printStatus(ctx context.Context, m *migrate.Migrator) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, s := range statuses {
+		state := "pending"
+		if s.Applied {
+			state = "applied " + s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%d_%s\t%s\n", s.Version, s.Name, state)
+	}
+	return nil
+}
@@ -2,13 +2,12 @@ package golib
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
 
-	"strconv"
-
 	"github.com/jinzhu/gorm"
 	log "github.com/sirupsen/logrus"
 )
@@ -19,6 +18,7 @@ var (
 	dbLogger        *log.Logger
 	isDebug         bool
 	dbReadMu        sync.Mutex
+	dbWriteMu       sync.Mutex
 )
 
 // DBLogFormatter database log formatter
@@ -54,7 +54,9 @@ func (f *DBLogFormatter) Format(entry *log.Entry) ([]byte, error) {
 	return b.Bytes(), nil
 }
 
-// InitDB function to initialize database log
+// InitDB function to initialize database log,
+// DEBUG=1 writes every query as json into STORAGE_DIR/logs/database.log, or into golib logger when the file cannot be opened,
+// DB_SLOW_QUERY_MS logs queries running at least that many milliseconds
 func InitDB() {
 	isDebug = false
 	if os.Getenv("DEBUG") == "1" {
@@ -62,75 +64,114 @@ func InitDB() {
 	}
 	fmt.Println(fmt.Sprintf("debug: %v", isDebug))
 
+	SetDBQueryLog(DBQueryLogConfigFromEnv())
+	dbLogger = nil
+	setDBQueryLogOutput(nil)
+
 	if isDebug {
-		dbLogger = log.New()
 		lf := fmt.Sprintf("%s/logs/database.log", os.Getenv("STORAGE_DIR"))
 
 		f, err := os.OpenFile(lf, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
 		if err != nil {
-			panic(err)
+			Log(WarnLevel, fmt.Sprintf("database log file unavailable, query log is written to golib logger: %v", err), "database", "init")
+			return
 		}
-		dbLogger.Formatter = &DBLogFormatter{EnableColor: false}
+		dbLogger = log.New()
+		dbLogger.Formatter = &log.JSONFormatter{}
 		dbLogger.Out = f
+		setDBQueryLogOutput(dbLogger)
 	}
 }
 
 // GetWriteDB function to get writing access to database
 func GetWriteDB() *gorm.DB {
+	dbWriteMu.Lock()
+	defer dbWriteMu.Unlock()
+
 	if dbWrite == nil {
-		dbWrite = CreateDBConnection(fmt.Sprintf("host=%s user=%s "+
-			"password=%s dbname=%s sslmode=disable",
-			os.Getenv("DBW_HOST"), os.Getenv("DBW_USER"), os.Getenv("DBW_PASS"), os.Getenv("DBW_NAME")))
+		dbWrite = withDBRole(mustDBConnection(envDBConfig("DBW")), DBRoleWrite, PrimaryReplicaName)
 	}
 	return dbWrite
 }
 
-// GetReadDB function to get reading access to database
+// GetReadDB function to get reading access to database,
+// when DBR_HOSTS lists several replicas a healthy one is selected on every call
 func GetReadDB() *gorm.DB {
+	if os.Getenv("DBR_HOSTS") != "" {
+		rs, err := GetReadReplicaSet()
+		if err != nil {
+			panic(err)
+		}
+		return rs.Get().DB
+	}
+
 	dbReadMu.Lock()
 	defer dbReadMu.Unlock()
 
 	if dbRead == nil {
-		//dbRead = CreateDBConnection(os.Getenv("DB_READ"))
-		dbRead = CreateDBConnection(fmt.Sprintf("host=%s user=%s "+
-			"password=%s dbname=%s sslmode=disable",
-			os.Getenv("DBR_HOST"), os.Getenv("DBR_USER"), os.Getenv("DBR_PASS"), os.Getenv("DBR_NAME")))
-
+		dbRead = withDBRole(mustDBConnection(envDBConfig("DBR")), DBRoleRead, "replica")
 	}
 	return dbRead
 }
 
-// CreateDBConnection function to create database connection
-func CreateDBConnection(descriptor string) *gorm.DB {
-	db, err := gorm.Open("postgres", descriptor)
+// envDBConfig function for reading database configuration from environment variables,
+// malformed values are logged and left at their defaults
+func envDBConfig(prefix string) DBConfig {
+	cfg, err := DBConfigFromEnv(prefix)
 	if err != nil {
-		defer db.Close()
-		return db
+		LogError(err, "database_config", prefix)
 	}
+	return cfg
+}
 
-	maxOpenCons, _ := strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONS"))
+// CreateDBConnection function to create database connection of DB_DIALECT, default postgres,
+// it panics when the database is unreachable, use NewDBConnection to handle the error
+func CreateDBConnection(descriptor string) *gorm.DB {
+	dialect := string(DBConfig{Dialect: DBDialect(os.Getenv("DB_DIALECT"))}.dialect())
+	db, err := openDB(context.Background(), dialect, dialect, descriptor, DBRetryConfig{MaxAttempts: 1})
+	if err != nil {
+		panic(err)
+	}
 
-	// set max idle connection to zero
-	db.DB().SetMaxIdleConns(0)
-	db.DB().SetMaxOpenConns(maxOpenCons)
+	pool, err := DBPoolConfigFromEnv("DB")
+	if err != nil {
+		LogError(err, "database_config", "DB")
+	}
+	configureDB(db, pool)
+	return db
+}
 
-	// set database log into file
-	if isDebug {
-		db.LogMode(true)
-		db.SetLogger(gorm.Logger{dbLogger})
+// mustDBConnection function to create database connection from configuration, it panics when the database is unreachable
+func mustDBConnection(cfg DBConfig) *gorm.DB {
+	dialect := string(cfg.dialect())
+	db, err := openDB(context.Background(), dialect, dialect, cfg.DSN(), DBRetryConfig{MaxAttempts: 1})
+	if err != nil {
+		panic(err)
 	}
 
+	configureDB(db, cfg.Pool)
 	return db
 }
 
 // CloseDb function for closing database connection
 func CloseDb() {
+	dbSplitMu.Lock()
+	dbSplit = nil
+	dbSplitMu.Unlock()
+
+	closeReadReplicaSet()
+
+	dbReadMu.Lock()
 	if dbRead != nil {
 		dbRead.Close()
 		dbRead = nil
 	}
+	dbReadMu.Unlock()
+
+	dbWriteMu.Lock()
 	if dbWrite != nil {
 		dbWrite.Close()
 		dbWrite = nil
 	}
+	dbWriteMu.Unlock()
 }
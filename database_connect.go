@@ -0,0 +1,142 @@
+package golib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DBRetryConfig retry of database connection at startup
+type DBRetryConfig struct {
+	// MaxAttempts maximum connection attempts, zero retries until Timeout
+	MaxAttempts int `json:"maxAttempts"`
+	// InitialBackoff wait after the first failed attempt, default 500ms
+	InitialBackoff time.Duration `json:"initialBackoff"`
+	// MaxBackoff maximum wait between attempts, default 10s
+	MaxBackoff time.Duration `json:"maxBackoff"`
+	// Timeout deadline of all attempts, default one minute
+	Timeout time.Duration `json:"timeout"`
+}
+
+// withDefaults function for filling zero values of retry configuration
+func (r DBRetryConfig) withDefaults() DBRetryConfig {
+	if r.InitialBackoff <= 0 {
+		r.InitialBackoff = 500 * time.Millisecond
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = 10 * time.Second
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		r.MaxBackoff = r.InitialBackoff
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = time.Minute
+	}
+	return r
+}
+
+// backoff function for getting wait after failed attempt, exponential with jitter in [d/2, d]
+func (r DBRetryConfig) backoff(attempt int) time.Duration {
+	d := r.InitialBackoff
+	for i := 1; i < attempt && d < r.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// NewDBConnection function for creating database connection of cfg.Dialect from configuration,
+// the driver of the dialect must be imported by the caller, the connection is retried with exponential backoff until cfg.Retry is exhausted
+// and the database is pinged before it is returned
+// ctx context.Context cancelling the retries
+// cfg DBConfig
+func NewDBConnection(ctx context.Context, cfg DBConfig) (*gorm.DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	dialect := string(cfg.dialect())
+	db, err := openDB(ctx, dialect, dialect, cfg.DSN(), cfg.Retry)
+	if err != nil {
+		return nil, err
+	}
+	configureDB(db, cfg.Pool)
+	return db, nil
+}
+
+// openDB function for opening database with retries
+func openDB(ctx context.Context, driver, dialect, dsn string, retry DBRetryConfig) (*gorm.DB, error) {
+	retry = retry.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, retry.Timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		db, err := openDBOnce(ctx, driver, dialect, dsn)
+		if err == nil {
+			LogCtx(ctx, InfoLevel, fmt.Sprintf("database connected after %d attempt(s)", attempt), "database", "connect",
+				map[string]interface{}{"attempt": attempt})
+			return db, nil
+		}
+		if _, ok := err.(permanentDBError); ok {
+			LogErrorCtx(ctx, err, "database", map[string]interface{}{"attempt": attempt})
+			return nil, err
+		}
+
+		if retry.MaxAttempts > 0 && attempt >= retry.MaxAttempts {
+			LogErrorCtx(ctx, err, "database", map[string]interface{}{"attempt": attempt})
+			return nil, fmt.Errorf("database connection failed after %d attempt(s): %v", attempt, err)
+		}
+
+		wait := retry.backoff(attempt)
+		LogCtx(ctx, WarnLevel, fmt.Sprintf("database connection attempt %d failed, retrying in %s", attempt, wait), "database", "connect",
+			map[string]interface{}{"attempt": attempt, "error": err.Error()})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			LogErrorCtx(ctx, err, "database", map[string]interface{}{"attempt": attempt})
+			return nil, fmt.Errorf("database connection failed after %d attempt(s): %v", attempt, err)
+		case <-timer.C:
+		}
+	}
+}
+
+// permanentDBError error which is not fixed by retrying such as unknown driver
+type permanentDBError struct {
+	error
+}
+
+// openDBOnce function for opening and pinging database once
+func openDBOnce(ctx context.Context, driver, dialect, dsn string) (*gorm.DB, error) {
+	sqlDB, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, permanentDBError{err}
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	db, err := gorm.Open(dialect, sqlDB)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// configureDB function for applying pool settings, tracing and query log of golib connections
+func configureDB(db *gorm.DB, pool DBPoolConfig) {
+	pool.apply(db.DB())
+	RegisterTracingCallbacks(db)
+	RegisterQueryLogCallbacks(db)
+	enableStatementLogger(db)
+}
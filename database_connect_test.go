@@ -0,0 +1,91 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBRetryConfigBackoff(t *testing.T) {
+	t.Run("SUCCESS backoff", func(t *testing.T) {
+		r := DBRetryConfig{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}.withDefaults()
+		for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+			d := r.backoff(attempt)
+			assert.True(t, d >= max/2 && d <= max, "attempt %d waited %s", attempt, d)
+		}
+	})
+}
+
+func TestOpenDB(t *testing.T) {
+	retry := DBRetryConfig{InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond, Timeout: time.Second}
+
+	t.Run("SUCCESS AFTER RETRY openDB", func(t *testing.T) {
+		_, mock, err := sqlmock.NewWithDSN("open_db_retry", sqlmock.MonitorPingsOption(true))
+		assert.NoError(t, err)
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing()
+		mock.ExpectPing()
+
+		db, err := openDB(context.Background(), "sqlmock", "postgres", "open_db_retry", retry)
+		assert.NoError(t, err)
+		assert.NotNil(t, db)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("MAX ATTEMPTS openDB", func(t *testing.T) {
+		_, mock, err := sqlmock.NewWithDSN("open_db_attempts", sqlmock.MonitorPingsOption(true))
+		assert.NoError(t, err)
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+		retry := retry
+		retry.MaxAttempts = 2
+		db, err := openDB(context.Background(), "sqlmock", "postgres", "open_db_attempts", retry)
+		assert.Nil(t, db)
+		assert.EqualError(t, err, "database connection failed after 2 attempt(s): connection refused")
+	})
+
+	t.Run("DEADLINE openDB", func(t *testing.T) {
+		_, mock, err := sqlmock.NewWithDSN("open_db_deadline", sqlmock.MonitorPingsOption(true))
+		assert.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = openDB(ctx, "sqlmock", "postgres", "open_db_deadline", retry)
+		assert.Error(t, err)
+	})
+
+	t.Run("UNKNOWN DRIVER openDB", func(t *testing.T) {
+		start := time.Now()
+		_, err := openDB(context.Background(), "unknown", "postgres", "", DBRetryConfig{InitialBackoff: time.Second})
+		assert.Error(t, err)
+		assert.True(t, time.Since(start) < time.Second)
+	})
+}
+
+func TestNewDBConnection(t *testing.T) {
+	t.Run("INVALID CONFIG NewDBConnection", func(t *testing.T) {
+		db, err := NewDBConnection(context.Background(), DBConfig{})
+		assert.Nil(t, db)
+		assert.Error(t, err)
+	})
+	t.Run("SQLITE NewDBConnection", func(t *testing.T) {
+		db, err := NewDBConnection(context.Background(), NewSQLiteDBConfig(SQLiteMemory))
+		assert.NoError(t, err)
+		defer db.Close()
+
+		var n int
+		assert.NoError(t, db.Raw("SELECT 1").Row().Scan(&n))
+		assert.Equal(t, 1, n)
+		assert.Equal(t, "sqlite3", db.Dialect().GetName())
+	})
+}
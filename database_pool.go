@@ -0,0 +1,198 @@
+package golib
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultDBPoolStatsInterval interval of StartDBPoolStatsLogger when the given interval is not positive
+const DefaultDBPoolStatsInterval = time.Minute
+
+// DBPoolConfig connection pool settings
+type DBPoolConfig struct {
+	// MaxOpenConns maximum open connections, zero is unlimited
+	MaxOpenConns int `json:"maxOpenConns"`
+	// MaxIdleConns maximum idle connections, zero keeps database/sql default of two, negative keeps no idle connection
+	MaxIdleConns int `json:"maxIdleConns"`
+	// ConnMaxLifetime maximum lifetime of a connection, zero is unlimited
+	ConnMaxLifetime time.Duration `json:"connMaxLifetime"`
+	// ConnMaxIdleTime maximum idle time of a connection, zero is unlimited, applied when built with Go 1.15 or newer
+	ConnMaxIdleTime time.Duration `json:"connMaxIdleTime"`
+}
+
+// DBPoolStat statistics of a connection pool
+type DBPoolStat struct {
+	// Name of the pool, "primary", "replica" or the name of a replica
+	Name string `json:"name"`
+	// Role DBRoleWrite or DBRoleRead
+	Role  string      `json:"role"`
+	Stats sql.DBStats `json:"stats"`
+}
+
+// DBPoolConfigFromEnv function for reading pool settings from environment variables
+// <prefix>_MAX_OPEN_CONS, <prefix>_MAX_IDLE_CONS, <prefix>_CONN_MAX_LIFETIME and <prefix>_CONN_MAX_IDLE_TIME (seconds),
+// unset variables fall back to the DB_ prefixed variable shared by every pool
+// prefix string such as "DBW" or "DBR"
+func DBPoolConfigFromEnv(prefix string) (DBPoolConfig, error) {
+	var cfg DBPoolConfig
+	var err error
+
+	if cfg.MaxOpenConns, err = poolEnvInt(prefix, "MAX_OPEN_CONS"); err != nil {
+		return cfg, err
+	}
+	if cfg.MaxIdleConns, err = poolEnvInt(prefix, "MAX_IDLE_CONS"); err != nil {
+		return cfg, err
+	}
+
+	seconds, err := poolEnvInt(prefix, "CONN_MAX_LIFETIME")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.ConnMaxLifetime = time.Duration(seconds) * time.Second
+
+	if seconds, err = poolEnvInt(prefix, "CONN_MAX_IDLE_TIME"); err != nil {
+		return cfg, err
+	}
+	cfg.ConnMaxIdleTime = time.Duration(seconds) * time.Second
+	return cfg, nil
+}
+
+// poolEnvInt function for reading <prefix>_<name>, falling back to DB_<name>
+func poolEnvInt(prefix, name string) (int, error) {
+	key := prefix + "_" + name
+	v := os.Getenv(key)
+	if v == "" {
+		key = "DB_" + name
+		v = os.Getenv(key)
+	}
+	if v == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return n, nil
+}
+
+// apply function for applying pool settings into database
+func (p DBPoolConfig) apply(db *sql.DB) {
+	db.SetMaxOpenConns(p.MaxOpenConns)
+	if p.MaxIdleConns != 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	setConnMaxIdleTime(db, p.ConnMaxIdleTime)
+}
+
+// GetDBPoolStats function for getting statistics of write, read and replica pools already connected
+func GetDBPoolStats() []DBPoolStat {
+	var stats []DBPoolStat
+
+	dbWriteMu.Lock()
+	if dbWrite != nil {
+		stats = append(stats, DBPoolStat{Name: PrimaryReplicaName, Role: DBRoleWrite, Stats: dbWrite.DB().Stats()})
+	}
+	dbWriteMu.Unlock()
+
+	dbReadMu.Lock()
+	if dbRead != nil {
+		stats = append(stats, DBPoolStat{Name: "replica", Role: DBRoleRead, Stats: dbRead.DB().Stats()})
+	}
+	dbReadMu.Unlock()
+
+	readReplicasMu.Lock()
+	if readReplicas != nil {
+		stats = append(stats, readReplicas.PoolStats()...)
+	}
+	readReplicasMu.Unlock()
+
+	return stats
+}
+
+// PoolStats function for getting statistics of every connected replica
+func (rs *ReplicaSet) PoolStats() []DBPoolStat {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	stats := make([]DBPoolStat, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		r.mu.Lock()
+		db := r.DB
+		r.mu.Unlock()
+		if db != nil {
+			stats = append(stats, DBPoolStat{Name: r.Name, Role: DBRoleRead, Stats: db.DB().Stats()})
+		}
+	}
+	return stats
+}
+
+// StartDBPoolStatsLogger function for logging statistics of every pool periodically,
+// pools whose wait count grew since the previous report are logged at warning level
+// interval time.Duration between reports, DefaultDBPoolStatsInterval when it is not positive
+// it returns function stopping the logger and waiting for the running report
+func StartDBPoolStatsLogger(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultDBPoolStatsInterval
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	var once sync.Once
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		previous := map[string]sql.DBStats{}
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, s := range GetDBPoolStats() {
+					logDBPoolStat(s, previous[s.Name])
+					previous[s.Name] = s.Stats
+				}
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-stopped
+	}
+}
+
+// logDBPoolStat function for logging statistics of pool compared with the previous report
+func logDBPoolStat(s DBPoolStat, previous sql.DBStats) {
+	waits := s.Stats.WaitCount - previous.WaitCount
+	waited := s.Stats.WaitDuration - previous.WaitDuration
+
+	level := InfoLevel
+	message := fmt.Sprintf("database pool %s", s.Name)
+	if waits > 0 {
+		level = WarnLevel
+		message = fmt.Sprintf("database pool %s exhausted, %d queries waited %s for a connection", s.Name, waits, waited)
+	}
+
+	Log(level, message, "database", "pool", map[string]interface{}{
+		"db_pool":          s.Name,
+		"db_role":          s.Role,
+		"max_open":         s.Stats.MaxOpenConnections,
+		"open":             s.Stats.OpenConnections,
+		"in_use":           s.Stats.InUse,
+		"idle":             s.Stats.Idle,
+		"wait_count":       s.Stats.WaitCount,
+		"wait_duration_ms": float64(s.Stats.WaitDuration) / float64(time.Millisecond),
+		"waits":            waits,
+		"waited_ms":        float64(waited) / float64(time.Millisecond),
+	})
+}
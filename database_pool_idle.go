@@ -0,0 +1,14 @@
+//go:build go1.15
+// +build go1.15
+
+package golib
+
+import (
+	"database/sql"
+	"time"
+)
+
+// setConnMaxIdleTime function for applying maximum idle time of connections, sql.DB supports it since Go 1.15
+func setConnMaxIdleTime(db *sql.DB, d time.Duration) {
+	db.SetConnMaxIdleTime(d)
+}
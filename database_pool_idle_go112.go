@@ -0,0 +1,12 @@
+//go:build !go1.15
+// +build !go1.15
+
+package golib
+
+import (
+	"database/sql"
+	"time"
+)
+
+// setConnMaxIdleTime function for ignoring maximum idle time of connections, sql.DB of Go before 1.15 lacks it
+func setConnMaxIdleTime(db *sql.DB, d time.Duration) {}
@@ -0,0 +1,121 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDBPoolConfigFromEnv(t *testing.T) {
+	t.Run("SUCCESS DBPoolConfigFromEnv", func(t *testing.T) {
+		os.Setenv("DB_MAX_OPEN_CONS", "20")
+		os.Setenv("DBR_MAX_OPEN_CONS", "50")
+		os.Setenv("DB_MAX_IDLE_CONS", "5")
+		os.Setenv("DB_CONN_MAX_LIFETIME", "300")
+		os.Setenv("DBR_CONN_MAX_IDLE_TIME", "60")
+		defer os.Unsetenv("DB_MAX_OPEN_CONS")
+		defer os.Unsetenv("DBR_MAX_OPEN_CONS")
+		defer os.Unsetenv("DB_MAX_IDLE_CONS")
+		defer os.Unsetenv("DB_CONN_MAX_LIFETIME")
+		defer os.Unsetenv("DBR_CONN_MAX_IDLE_TIME")
+
+		read, err := DBPoolConfigFromEnv("DBR")
+		assert.NoError(t, err)
+		assert.Equal(t, DBPoolConfig{MaxOpenConns: 50, MaxIdleConns: 5, ConnMaxLifetime: 5 * time.Minute, ConnMaxIdleTime: time.Minute}, read)
+
+		write, err := DBPoolConfigFromEnv("DBW")
+		assert.NoError(t, err)
+		assert.Equal(t, 20, write.MaxOpenConns)
+		assert.Equal(t, time.Duration(0), write.ConnMaxIdleTime)
+	})
+
+	t.Run("ERROR DBPoolConfigFromEnv", func(t *testing.T) {
+		os.Setenv("DBW_MAX_IDLE_CONS", "many")
+		defer os.Unsetenv("DBW_MAX_IDLE_CONS")
+
+		_, err := DBPoolConfigFromEnv("DBW")
+		assert.EqualError(t, err, `invalid DBW_MAX_IDLE_CONS: strconv.Atoi: parsing "many": invalid syntax`)
+	})
+}
+
+func TestDBPoolConfigApply(t *testing.T) {
+	t.Run("SUCCESS apply", func(t *testing.T) {
+		sqlDB, _, _ := sqlmock.New()
+		defer sqlDB.Close()
+
+		DBPoolConfig{MaxOpenConns: 7}.apply(sqlDB)
+		assert.Equal(t, 7, sqlDB.Stats().MaxOpenConnections)
+	})
+}
+
+func TestGetDBPoolStats(t *testing.T) {
+	defer closeLoggerOutputs()
+
+	writeDB, _ := newMockGormDB(t)
+	readDB, _ := newMockGormDB(t)
+
+	dbWriteMu.Lock()
+	previousWrite := dbWrite
+	dbWrite = writeDB
+	dbWriteMu.Unlock()
+	dbReadMu.Lock()
+	previousRead := dbRead
+	dbRead = readDB
+	dbReadMu.Unlock()
+	defer func() {
+		dbWriteMu.Lock()
+		dbWrite = previousWrite
+		dbWriteMu.Unlock()
+		dbReadMu.Lock()
+		dbRead = previousRead
+		dbReadMu.Unlock()
+	}()
+
+	t.Run("SUCCESS GetDBPoolStats", func(t *testing.T) {
+		stats := GetDBPoolStats()
+		assert.Len(t, stats, 2)
+		assert.Equal(t, PrimaryReplicaName, stats[0].Name)
+		assert.Equal(t, DBRoleWrite, stats[0].Role)
+		assert.Equal(t, DBRoleRead, stats[1].Role)
+	})
+
+	t.Run("EXHAUSTED logDBPoolStat", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf}}}))
+
+		logDBPoolStat(DBPoolStat{Name: "primary", Role: DBRoleWrite, Stats: sql.DBStats{WaitCount: 5, WaitDuration: time.Second}},
+			sql.DBStats{WaitCount: 2, WaitDuration: 400 * time.Millisecond})
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.Contains(t, buf.String(), `"level":"warning"`)
+		assert.Contains(t, buf.String(), `3 queries waited 600ms`)
+		assert.Contains(t, buf.String(), `"waits":3`)
+	})
+
+	t.Run("SUCCESS StartDBPoolStatsLogger", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf}}}))
+
+		stop := StartDBPoolStatsLogger(10 * time.Millisecond)
+		time.Sleep(35 * time.Millisecond)
+		stop()
+		stop()
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.Contains(t, buf.String(), `"db_pool":"primary"`)
+		assert.Contains(t, buf.String(), `"db_pool":"replica"`)
+	})
+
+	t.Run("DEFAULT INTERVAL StartDBPoolStatsLogger", func(t *testing.T) {
+		assert.NotPanics(t, func() {
+			stop := StartDBPoolStatsLogger(0)
+			stop()
+		})
+	})
+}
@@ -0,0 +1,385 @@
+package golib
+
+import (
+	"context"
+	"fmt"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// dbStartKey scope instance setting holding start time of the running operation
+	dbStartKey = "golib:query_start"
+	// maxQueryFingerprints number of fingerprints tracked, further statements are counted as "other"
+	maxQueryFingerprints = 1000
+	// otherQueryFingerprint fingerprint of statements over maxQueryFingerprints
+	otherQueryFingerprint = "other"
+	// dbStatementLogKey gorm setting marking golib connections whose gorm logger is a dbStatementLogger
+	dbStatementLogKey = "golib:statement_log"
+	// dbSilencedKey scope instance setting marking operation whose gorm log was turned off by silenceStatementLogger
+	dbSilencedKey = "golib:statement_log_silenced"
+	// gormDetailedLogMode value of the unexported log mode of gorm set by LogMode(true)
+	gormDetailedLogMode = 2
+)
+
+// DBQueryLatencyBuckets upper bounds of query latency histogram, the last bucket counts slower queries
+var DBQueryLatencyBuckets = []time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+var (
+	// inListRegexp lists of masked values collapsed by fingerprints
+	inListRegexp = regexp.MustCompile(`\(\s*(?:\?|\$\d+)(?:\s*,\s*(?:\?|\$\d+))*\s*\)`)
+	// spaceRegexp runs of white space collapsed by fingerprints
+	spaceRegexp = regexp.MustCompile(`\s+`)
+
+	queryLogMu  sync.RWMutex
+	queryLogCfg DBQueryLogConfig
+	queryLogOut *log.Logger
+
+	queryStatsMu sync.Mutex
+	queryStats   = map[string]*DBQueryStats{}
+)
+
+// DBQueryLogConfig configuration of query log
+type DBQueryLogConfig struct {
+	// SlowThreshold queries running at least this long are logged at warning level, zero disables the slow-query log
+	SlowThreshold time.Duration
+	// LogAll every query is logged at info level, enabled by DEBUG=1
+	LogAll bool
+}
+
+// DBQueryStats counters and latency histogram of a statement fingerprint
+type DBQueryStats struct {
+	// Fingerprint statement with literals masked and white space collapsed
+	Fingerprint string `json:"fingerprint"`
+	Count       uint64 `json:"count"`
+	Errors      uint64 `json:"errors"`
+	Rows        int64  `json:"rows"`
+	// TotalDuration sum of durations
+	TotalDuration time.Duration `json:"totalDuration"`
+	// MaxDuration slowest execution
+	MaxDuration time.Duration `json:"maxDuration"`
+	// Buckets number of executions per DBQueryLatencyBuckets bound, with one extra bucket for slower executions
+	Buckets []uint64 `json:"buckets"`
+}
+
+// SetDBQueryLog function for configuring query log
+func SetDBQueryLog(cfg DBQueryLogConfig) {
+	queryLogMu.Lock()
+	queryLogCfg = cfg
+	queryLogMu.Unlock()
+}
+
+// setDBQueryLogOutput function for writing query log into l instead of golib logger, nil restores golib logger
+func setDBQueryLogOutput(l *log.Logger) {
+	queryLogMu.Lock()
+	queryLogOut = l
+	queryLogMu.Unlock()
+}
+
+// getDBQueryLog function for getting query log configuration and output
+func getDBQueryLog() (DBQueryLogConfig, *log.Logger) {
+	queryLogMu.RLock()
+	defer queryLogMu.RUnlock()
+	return queryLogCfg, queryLogOut
+}
+
+// DBQueryLogConfigFromEnv function for reading query log configuration,
+// DEBUG=1 logs every query and DB_SLOW_QUERY_MS sets the slow-query threshold
+func DBQueryLogConfigFromEnv() DBQueryLogConfig {
+	cfg := DBQueryLogConfig{LogAll: os.Getenv("DEBUG") == "1"}
+	if ms, err := strconv.Atoi(os.Getenv("DB_SLOW_QUERY_MS")); err == nil && ms > 0 {
+		cfg.SlowThreshold = time.Duration(ms) * time.Millisecond
+	}
+	return cfg
+}
+
+// GetDBQueryStats function for getting statistics of every fingerprint ordered by total duration
+func GetDBQueryStats() []DBQueryStats {
+	queryStatsMu.Lock()
+	stats := make([]DBQueryStats, 0, len(queryStats))
+	for _, s := range queryStats {
+		c := *s
+		c.Buckets = append([]uint64(nil), s.Buckets...)
+		stats = append(stats, c)
+	}
+	queryStatsMu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].TotalDuration > stats[j].TotalDuration
+	})
+	return stats
+}
+
+// ResetDBQueryStats function for clearing query statistics
+func ResetDBQueryStats() {
+	queryStatsMu.Lock()
+	queryStats = map[string]*DBQueryStats{}
+	queryStatsMu.Unlock()
+}
+
+// QueryFingerprint function for normalizing statement so executions with different values share statistics
+func QueryFingerprint(statement string) string {
+	s := maskSQL(statement)
+	s = inListRegexp.ReplaceAllString(s, "(?+)")
+	return strings.TrimSpace(spaceRegexp.ReplaceAllString(s, " "))
+}
+
+// RegisterQueryLogCallbacks function for registering gorm callbacks recording statistics
+// and writing query log of create, query, update, delete and raw row query
+// db *gorm.DB
+func RegisterQueryLogCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	if cb.Create().Get("golib:query_log_before_create") != nil {
+		return
+	}
+
+	cb.Create().Before("gorm:begin_transaction").Register("golib:query_log_before_create", queryLogBefore)
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("golib:query_log_after_create", queryLogAfter)
+	cb.Update().Before("gorm:begin_transaction").Register("golib:query_log_before_update", queryLogBefore)
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("golib:query_log_after_update", queryLogAfter)
+	cb.Delete().Before("gorm:begin_transaction").Register("golib:query_log_before_delete", queryLogBefore)
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("golib:query_log_after_delete", queryLogAfter)
+	cb.Query().Before("gorm:query").Register("golib:query_log_before_query", queryLogBefore)
+	cb.Query().After("gorm:after_query").Register("golib:query_log_after_query", queryLogAfter)
+	cb.RowQuery().Before("gorm:row_query").Register("golib:query_log_before_row_query", queryLogBefore)
+	cb.RowQuery().After("gorm:row_query").Register("golib:query_log_after_row_query", rowQueryLogAfter)
+}
+
+// queryLogBefore callback recording start time of operation
+func queryLogBefore(scope *gorm.Scope) {
+	scope.InstanceSet(dbStartKey, time.Now())
+	silenceStatementLogger(scope)
+}
+
+// queryLogAfter callback recording statistics and writing query log of operation
+func queryLogAfter(scope *gorm.Scope) {
+	restoreStatementLogger(scope, false)
+	recordScopeQuery(scope)
+}
+
+// rowQueryLogAfter callback recording statistics and writing query log of raw row query
+func rowQueryLogAfter(scope *gorm.Scope) {
+	restoreStatementLogger(scope, true)
+	recordScopeQuery(scope)
+}
+
+// recordScopeQuery function for recording statistics and writing query log of statement of scope
+func recordScopeQuery(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet(dbStartKey)
+	if !ok || scope.SQL == "" {
+		return
+	}
+	duration := time.Since(v.(time.Time))
+	rows := scope.DB().RowsAffected
+	err := scope.DB().Error
+	if gorm.IsRecordNotFoundError(err) {
+		err = nil
+	}
+
+	role, _ := scopeDBRole(scope)
+	logQuery(TxContext(scope.DB()), scope.SQL, duration, rows, err, role)
+}
+
+// logQuery function for recording statistics and writing query log of executed statement
+func logQuery(ctx context.Context, statement string, duration time.Duration, rows int64, err error, role string) {
+	fingerprint := QueryFingerprint(statement)
+	recordQueryStats(fingerprint, duration, rows, err)
+
+	cfg, out := getDBQueryLog()
+	slow := cfg.SlowThreshold > 0 && duration >= cfg.SlowThreshold
+	if !slow && !cfg.LogAll {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"statement":   maskSQL(statement),
+		"fingerprint": fingerprint,
+		"duration_ms": float64(duration) / float64(time.Millisecond),
+		"rows":        rows,
+		"caller":      queryCaller(),
+		"slow":        slow,
+	}
+	if traceID := TraceIDFromContext(ctx); traceID != "" {
+		fields["trace_id"] = traceID
+	}
+	if role != "" {
+		fields["db_role"] = role
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	level := InfoLevel
+	message := "database query"
+	if slow {
+		level = WarnLevel
+		message = fmt.Sprintf("slow database query took %s", duration)
+	}
+
+	if out != nil {
+		out.WithFields(log.Fields(fields)).Log(log.Level(level), message)
+		return
+	}
+	LogCtx(ctx, level, message, "database", "query", fields)
+}
+
+// recordQueryStats function for adding execution into statistics of fingerprint
+func recordQueryStats(fingerprint string, duration time.Duration, rows int64, err error) {
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+
+	s, ok := queryStats[fingerprint]
+	if !ok {
+		if len(queryStats) >= maxQueryFingerprints {
+			fingerprint = otherQueryFingerprint
+			s = queryStats[fingerprint]
+		}
+		if s == nil {
+			s = &DBQueryStats{Fingerprint: fingerprint, Buckets: make([]uint64, len(DBQueryLatencyBuckets)+1)}
+			queryStats[fingerprint] = s
+		}
+	}
+
+	s.Count++
+	if err != nil {
+		s.Errors++
+	}
+	s.Rows += rows
+	s.TotalDuration += duration
+	if duration > s.MaxDuration {
+		s.MaxDuration = duration
+	}
+
+	i := sort.Search(len(DBQueryLatencyBuckets), func(i int) bool {
+		return duration <= DBQueryLatencyBuckets[i]
+	})
+	s.Buckets[i]++
+}
+
+// queryCaller function for getting file:line of the code which called gorm
+func queryCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "github.com/jinzhu/gorm.") && !strings.HasSuffix(frame.File, "database_querylog.go") {
+			return filepath.Base(filepath.Dir(frame.File)) + "/" + filepath.Base(frame.File) + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
+
+// dbStatementLogger gorm logger of golib connections recording statements which gorm runs without callbacks,
+// such as db.Exec, savepoints and schema changes, into query log and tracing,
+// other messages are written like the default gorm logger
+type dbStatementLogger struct {
+	ctx      context.Context
+	role     string
+	instance string
+	// skip set to 1 ignores the next statement, already recorded by the row query callbacks
+	skip *int32
+}
+
+// newStatementLogger function for creating gorm logger of golib connection db bound to its context and role
+func newStatementLogger(db *gorm.DB) dbStatementLogger {
+	l := dbStatementLogger{ctx: TxContext(db)}
+	if v, ok := db.Get(dbRoleKey); ok {
+		l.role, _ = v.(string)
+	}
+	if v, ok := db.Get(dbInstanceKey); ok {
+		l.instance, _ = v.(string)
+	}
+	return l
+}
+
+// withStatementLogger function for binding gorm logger of golib connection db to its current context and role,
+// called whenever those settings change, other connections are returned unchanged
+func withStatementLogger(db *gorm.DB) *gorm.DB {
+	if _, ok := db.Get(dbStatementLogKey); !ok {
+		return db
+	}
+	db.SetLogger(newStatementLogger(db))
+	return db
+}
+
+// enableStatementLogger function for replacing gorm logger of db by dbStatementLogger,
+// gorm only prints statements in detailed log mode so LogMode(false) on the connection stops recording raw statements
+func enableStatementLogger(db *gorm.DB) {
+	db.InstantSet(dbStatementLogKey, true)
+	db.LogMode(true)
+	withStatementLogger(db)
+}
+
+// silenceStatementLogger function for turning gorm log off while callbacks of golib connection run,
+// their statements are recorded by queryLogAfter so only statements run without callbacks reach dbStatementLogger
+func silenceStatementLogger(scope *gorm.Scope) {
+	if _, ok := scope.Get(dbStatementLogKey); !ok || !isDetailedLogMode(scope.DB()) {
+		return
+	}
+	scope.InstanceSet(dbSilencedKey, true)
+	scope.DB().LogMode(false)
+}
+
+// restoreStatementLogger function for turning gorm log of golib connection on again once its callbacks ran,
+// gorm prints the statement of row queries after the callbacks so skipNext ignores it
+func restoreStatementLogger(scope *gorm.Scope, skipNext bool) {
+	if _, ok := scope.InstanceGet(dbSilencedKey); !ok {
+		return
+	}
+	db := scope.DB()
+	db.LogMode(true)
+	if skipNext {
+		l := newStatementLogger(db)
+		l.skip = new(int32)
+		*l.skip = 1
+		db.SetLogger(l)
+	}
+}
+
+// isDetailedLogMode function for checking whether gorm prints statements of db, gorm keeps the log mode unexported
+func isDetailedLogMode(db *gorm.DB) bool {
+	mode := reflect.ValueOf(db).Elem().FieldByName("logMode")
+	return mode.IsValid() && mode.Int() == gormDetailedLogMode
+}
+
+// Print function for recording statement printed by gorm, statements of callbacks are recorded by queryLogAfter
+func (l dbStatementLogger) Print(v ...interface{}) {
+	if len(v) < 6 || v[0] != "sql" {
+		_, out := getDBQueryLog()
+		if out != nil {
+			gorm.Logger{LogWriter: out}.Print(v...)
+			return
+		}
+		gorm.Logger{LogWriter: stdlog.New(os.Stdout, "\r\n", 0)}.Print(v...)
+		return
+	}
+	if l.skip != nil && atomic.CompareAndSwapInt32(l.skip, 1, 0) {
+		return
+	}
+
+	duration, _ := v[2].(time.Duration)
+	statement, _ := v[3].(string)
+	rows, _ := v[5].(int64)
+	logQuery(l.ctx, statement, duration, rows, nil, l.role)
+	traceStatement(l.ctx, statement, duration, rows, l.role, l.instance)
+}
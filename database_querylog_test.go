@@ -0,0 +1,146 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryFingerprint(t *testing.T) {
+	t.Run("SUCCESS QueryFingerprint", func(t *testing.T) {
+		a := QueryFingerprint("SELECT * FROM orders WHERE id IN (1, 2, 3) AND status = 'paid'")
+		b := QueryFingerprint("SELECT *  FROM orders\n WHERE id IN ($1,$2) AND status = 'new'")
+		assert.Equal(t, "SELECT * FROM orders WHERE id IN (?+) AND status = ?", a)
+		assert.Equal(t, a, b)
+	})
+}
+
+func TestRegisterQueryLogCallbacks(t *testing.T) {
+	defer closeLoggerOutputs()
+	defer SetDBQueryLog(DBQueryLogConfig{})
+	defer ResetDBQueryStats()
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf}}}))
+
+	db, mock := newMockGormDB(t)
+	RegisterQueryLogCallbacks(db)
+	RegisterQueryLogCallbacks(db)
+
+	t.Run("SLOW QUERY RegisterQueryLogCallbacks", func(t *testing.T) {
+		ResetDBQueryStats()
+		SetDBQueryLog(DBQueryLogConfig{SlowThreshold: 20 * time.Millisecond})
+		mock.ExpectQuery("SELECT").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery("SELECT").WillDelayFor(30 * time.Millisecond).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2).AddRow(3))
+
+		var orders []tracedOrder
+		assert.NoError(t, db.Where("id = 1").Find(&orders).Error)
+		assert.NoError(t, db.Where("id = 2").Find(&orders).Error)
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 1)
+
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+		assert.Equal(t, "warning", entry["level"])
+		assert.Equal(t, float64(2), entry["rows"])
+		assert.True(t, entry["duration_ms"].(float64) >= 20)
+		assert.Contains(t, entry["caller"], "database_querylog_test.go:")
+		assert.Equal(t, `SELECT * FROM "traced_orders"  WHERE (id = ?)`, entry["statement"])
+
+		stats := GetDBQueryStats()
+		assert.Len(t, stats, 1)
+		assert.Equal(t, uint64(2), stats[0].Count)
+		assert.Equal(t, int64(3), stats[0].Rows)
+		var total uint64
+		for _, b := range stats[0].Buckets {
+			total += b
+		}
+		assert.Equal(t, uint64(2), total)
+	})
+
+	t.Run("ERROR RegisterQueryLogCallbacks", func(t *testing.T) {
+		ResetDBQueryStats()
+		mock.ExpectQuery("SELECT").WillReturnError(assert.AnError)
+
+		var orders []tracedOrder
+		assert.Error(t, db.Find(&orders).Error)
+		assert.Equal(t, uint64(1), GetDBQueryStats()[0].Errors)
+	})
+}
+
+func TestStatementLogger(t *testing.T) {
+	defer closeLoggerOutputs()
+	defer SetDBQueryLog(DBQueryLogConfig{})
+	defer ResetDBQueryStats()
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf}}}))
+
+	db, mock := newMockGormDB(t)
+	configureDB(db, DBPoolConfig{})
+
+	t.Run("RAW EXEC StatementLogger", func(t *testing.T) {
+		ResetDBQueryStats()
+		SetDBQueryLog(DBQueryLogConfig{LogAll: true})
+		mock.ExpectExec("SAVEPOINT sp_1").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`UPDATE orders SET status = 'paid'`).WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE "traced_orders"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		assert.NoError(t, db.Exec("SAVEPOINT sp_1").Error)
+		assert.NoError(t, DBWithContext(context.Background(), db).Exec(`UPDATE orders SET status = 'paid'`).Error)
+		assert.NoError(t, db.Model(&tracedOrder{ID: 1}).Update("status", "paid").Error)
+		assert.NoError(t, FlushLogs(context.Background()))
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 3)
+
+		var entry map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+		assert.Equal(t, "UPDATE orders SET status = ?", entry["statement"])
+		assert.Equal(t, float64(4), entry["rows"])
+		assert.Contains(t, entry["caller"], "database_querylog_test.go:")
+
+		stats := GetDBQueryStats()
+		assert.Len(t, stats, 3)
+		for _, s := range stats {
+			assert.Equal(t, uint64(1), s.Count, s.Fingerprint)
+		}
+	})
+	t.Run("ROW QUERY StatementLogger", func(t *testing.T) {
+		ResetDBQueryStats()
+		buf.Reset()
+		SetDBQueryLog(DBQueryLogConfig{LogAll: true})
+		mock.ExpectQuery(`SELECT count\(\*\) FROM "traced_orders"`).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectQuery(`SELECT \* FROM "traced_orders"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec(`DELETE FROM orders`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var count int
+		var orders []tracedOrder
+		assert.NoError(t, db.Model(&tracedOrder{}).Count(&count).Error)
+		assert.NoError(t, db.Find(&orders).Error)
+		assert.NoError(t, db.Exec(`DELETE FROM orders`).Error)
+		assert.NoError(t, FlushLogs(context.Background()))
+		assert.NoError(t, mock.ExpectationsWereMet())
+		assert.Equal(t, 2, count)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 3)
+
+		stats := GetDBQueryStats()
+		assert.Len(t, stats, 3)
+		for _, s := range stats {
+			assert.Equal(t, uint64(1), s.Count, s.Fingerprint)
+		}
+	})
+}
@@ -0,0 +1,457 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ReplicaBalance selection strategy of ReplicaSet
+type ReplicaBalance string
+
+const (
+	// ReplicaRoundRobin healthy replicas are selected in turn
+	ReplicaRoundRobin ReplicaBalance = "round_robin"
+	// ReplicaLeastConnections healthy replica with the fewest in-use connections is selected
+	ReplicaLeastConnections ReplicaBalance = "least_connections"
+
+	// PrimaryReplicaName name of Replica returned when no replica is healthy
+	PrimaryReplicaName = "primary"
+
+	// replicaLagQuery seconds since the last transaction replayed by a postgres standby, zero when every received
+	// WAL record is replayed so a standby of an idle primary is not reported as lagging
+	replicaLagQuery = "SELECT CASE WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0 " +
+		"ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END"
+)
+
+// ReplicaSetConfig configuration of read replicas
+type ReplicaSetConfig struct {
+	// Nodes connection configuration of every replica
+	Nodes []DBConfig
+	// Balance selection strategy, default ReplicaRoundRobin
+	Balance ReplicaBalance
+	// HealthCheckInterval interval of health checks, default ten seconds
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout timeout of a single health check, default two seconds
+	HealthCheckTimeout time.Duration
+	// MaxLag replication lag which takes a replica out of rotation, zero disables the lag check,
+	// the lag is checked on postgres replicas only
+	MaxLag time.Duration
+}
+
+// Replica read replica of ReplicaSet
+type Replica struct {
+	// Name host:port of the replica, or PrimaryReplicaName for the write database fallback
+	Name string
+	// DB connection of the replica
+	DB *gorm.DB
+
+	cfg     DBConfig
+	healthy int32
+	mu      sync.Mutex
+	lag     time.Duration
+	lastErr error
+}
+
+// ReplicaStatus health of a replica
+type ReplicaStatus struct {
+	Name      string        `json:"name"`
+	Healthy   bool          `json:"healthy"`
+	Lag       time.Duration `json:"lag"`
+	LastError string        `json:"lastError,omitempty"`
+}
+
+// ReplicaSet read replicas balanced by health and load
+type ReplicaSet struct {
+	cfg      ReplicaSetConfig
+	primary  *Replica
+	mu       sync.RWMutex
+	replicas []*Replica
+	next     uint32
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// replicaNameKey context key of the replica chosen for a request
+type replicaNameKey struct{}
+
+var (
+	readReplicas   *ReplicaSet
+	readReplicasMu sync.Mutex
+)
+
+// ReplicaSetConfigFromEnv function for reading replica configuration from environment variables,
+// DBR_HOSTS holds comma separated host or host:port of every replica, other DBR_* variables are shared,
+// DBR_BALANCE selects round_robin or least_connections and DBR_MAX_LAG_SECONDS enables the lag check
+func ReplicaSetConfigFromEnv() (ReplicaSetConfig, error) {
+	base, err := DBConfigFromEnv("DBR")
+	if err != nil {
+		return ReplicaSetConfig{}, err
+	}
+
+	cfg := ReplicaSetConfig{Balance: ReplicaBalance(os.Getenv("DBR_BALANCE"))}
+	if v := os.Getenv("DBR_MAX_LAG_SECONDS"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid DBR_MAX_LAG_SECONDS: %v", err)
+		}
+		cfg.MaxLag = time.Duration(seconds) * time.Second
+	}
+
+	for _, host := range strings.Split(os.Getenv("DBR_HOSTS"), ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+
+		node := base
+		if node.Host, node.Port, err = splitReplicaHost(host, base.Port); err != nil {
+			return cfg, err
+		}
+		cfg.Nodes = append(cfg.Nodes, node)
+	}
+	return cfg, nil
+}
+
+// splitReplicaHost function for splitting host, host:port, [ipv6]:port, [ipv6] or bare ipv6 of DBR_HOSTS
+// host string
+// port int used when host has no port
+func splitReplicaHost(host string, port int) (string, int, error) {
+	if !strings.Contains(host, ":") {
+		return host, port, nil
+	}
+
+	h, p, err := net.SplitHostPort(host)
+	switch {
+	case err == nil:
+		if p == "" {
+			return h, port, nil
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid port of replica %s: %v", host, err)
+		}
+		return h, n, nil
+	case strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]"):
+		return host[1 : len(host)-1], port, nil
+	case strings.Count(host, ":") > 1 && !strings.Contains(host, "["):
+		return host, port, nil
+	}
+	return "", 0, fmt.Errorf("invalid address of replica %s: %v", host, err)
+}
+
+// NewReplicaSet function for connecting replicas in parallel and starting health checks, every replica gets
+// a single attempt within HealthCheckTimeout and replicas which cannot be reached are kept out of rotation
+// until a health check connects them
+// ctx context.Context of the initial connections
+// cfg ReplicaSetConfig
+// primary *gorm.DB write database used when no replica is healthy
+func NewReplicaSet(ctx context.Context, cfg ReplicaSetConfig, primary *gorm.DB) (*ReplicaSet, error) {
+	if primary == nil {
+		return nil, errors.New("replica set requires a primary database")
+	}
+	for _, node := range cfg.Nodes {
+		if err := node.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	rs := newReplicaSet(cfg, primary)
+	var wg sync.WaitGroup
+	for _, node := range cfg.Nodes {
+		r := &Replica{Name: replicaName(node), cfg: node}
+		rs.replicas = append(rs.replicas, r)
+
+		wg.Add(1)
+		go func(r *Replica) {
+			defer wg.Done()
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			if err := rs.connect(ctx, r); err != nil {
+				r.lastErr = err
+				return
+			}
+			atomic.StoreInt32(&r.healthy, 1)
+		}(r)
+	}
+	wg.Wait()
+
+	rs.start()
+	return rs, nil
+}
+
+// connect function for connecting replica with a single attempt bounded by the health check timeout,
+// so a dead replica delays neither the replica set nor its callers, caller holds r.mu
+func (rs *ReplicaSet) connect(ctx context.Context, r *Replica) error {
+	cfg := r.cfg
+	cfg.Retry = DBRetryConfig{MaxAttempts: 1, Timeout: rs.cfg.HealthCheckTimeout}
+	db, err := NewDBConnection(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	r.DB = withDBRole(db, DBRoleRead, r.Name)
+	return nil
+}
+
+// newReplicaSet function for creating replica set without replicas
+func newReplicaSet(cfg ReplicaSetConfig, primary *gorm.DB) *ReplicaSet {
+	if cfg.Balance == "" {
+		cfg.Balance = ReplicaRoundRobin
+	}
+	if cfg.HealthCheckInterval <= 0 {
+		cfg.HealthCheckInterval = 10 * time.Second
+	}
+	if cfg.HealthCheckTimeout <= 0 {
+		cfg.HealthCheckTimeout = 2 * time.Second
+	}
+
+	return &ReplicaSet{
+		cfg:     cfg,
+		primary: &Replica{Name: PrimaryReplicaName, DB: primary, healthy: 1},
+		stop:    make(chan struct{}),
+	}
+}
+
+// replicaName function for naming replica by its address
+func replicaName(cfg DBConfig) string {
+	return net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+}
+
+// AddReplica function for adding already connected replica into rotation
+// name string name reported by ReplicaFromContext
+// db *gorm.DB replica connection
+func (rs *ReplicaSet) AddReplica(name string, db *gorm.DB) {
+	rs.mu.Lock()
+	rs.replicas = append(rs.replicas, &Replica{Name: name, DB: withDBRole(db, DBRoleRead, name), healthy: 1})
+	rs.mu.Unlock()
+}
+
+// Get function for selecting healthy replica, the primary is returned when no replica is healthy
+func (rs *ReplicaSet) Get() *Replica {
+	rs.mu.RLock()
+	healthy := make([]*Replica, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		if r.Healthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	rs.mu.RUnlock()
+
+	if len(healthy) == 0 {
+		return rs.primary
+	}
+
+	if rs.cfg.Balance == ReplicaLeastConnections {
+		best := healthy[0]
+		bestInUse := best.DB.DB().Stats().InUse
+		for _, r := range healthy[1:] {
+			if inUse := r.DB.DB().Stats().InUse; inUse < bestInUse {
+				best, bestInUse = r, inUse
+			}
+		}
+		return best
+	}
+
+	n := atomic.AddUint32(&rs.next, 1)
+	return healthy[int(n-1)%len(healthy)]
+}
+
+// GetContext function for selecting replica and recording its name in ctx,
+// the name is written as db_replica field by LogCtx and returned by ReplicaFromContext,
+// the returned db carries ctx so its queries are traced as children of the span of ctx
+func (rs *ReplicaSet) GetContext(ctx context.Context) (context.Context, *gorm.DB) {
+	r := rs.Get()
+	ctx = context.WithValue(ctx, replicaNameKey{}, r.Name)
+	ctx = WithLogFields(ctx, map[string]interface{}{"db_replica": r.Name})
+	return ctx, DBWithContext(ctx, r.DB)
+}
+
+// ReplicaFromContext function for getting name of replica chosen by ReplicaSet.GetContext
+func ReplicaFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	name, _ := ctx.Value(replicaNameKey{}).(string)
+	return name
+}
+
+// Status function for getting health of every replica
+func (rs *ReplicaSet) Status() []ReplicaStatus {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+
+	status := make([]ReplicaStatus, 0, len(rs.replicas))
+	for _, r := range rs.replicas {
+		r.mu.Lock()
+		s := ReplicaStatus{Name: r.Name, Healthy: r.Healthy(), Lag: r.lag}
+		if r.lastErr != nil {
+			s.LastError = r.lastErr.Error()
+		}
+		r.mu.Unlock()
+		status = append(status, s)
+	}
+	return status
+}
+
+// CheckHealth function for checking every replica immediately
+func (rs *ReplicaSet) CheckHealth(ctx context.Context) {
+	rs.mu.RLock()
+	replicas := append([]*Replica(nil), rs.replicas...)
+	rs.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func(r *Replica) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, rs.cfg.HealthCheckTimeout)
+			defer cancel()
+			rs.check(checkCtx, r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// check function for updating health of replica
+func (rs *ReplicaSet) check(ctx context.Context, r *Replica) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.DB == nil {
+		if err := rs.connect(ctx, r); err != nil {
+			r.setHealth(false, err)
+			return
+		}
+	}
+
+	if err := r.DB.DB().PingContext(ctx); err != nil {
+		r.setHealth(false, err)
+		return
+	}
+
+	if rs.cfg.MaxLag > 0 && r.cfg.dialect() == DBDialectPostgres {
+		var seconds float64
+		if err := r.DB.DB().QueryRowContext(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+			r.setHealth(false, err)
+			return
+		}
+		r.lag = time.Duration(seconds * float64(time.Second))
+		if r.lag > rs.cfg.MaxLag {
+			r.setHealth(false, fmt.Errorf("replication lag %s exceeds %s", r.lag, rs.cfg.MaxLag))
+			return
+		}
+	}
+	r.setHealth(true, nil)
+}
+
+// setHealth function for changing health of replica and logging transitions, caller holds r.mu
+func (r *Replica) setHealth(healthy bool, err error) {
+	r.lastErr = err
+	if !healthy && atomic.CompareAndSwapInt32(&r.healthy, 1, 0) {
+		Log(WarnLevel, fmt.Sprintf("replica %s removed from rotation: %v", r.Name, err), "database", "replica",
+			map[string]interface{}{"db_replica": r.Name})
+	}
+	if healthy && atomic.CompareAndSwapInt32(&r.healthy, 0, 1) {
+		Log(InfoLevel, fmt.Sprintf("replica %s returned to rotation", r.Name), "database", "replica",
+			map[string]interface{}{"db_replica": r.Name})
+	}
+}
+
+// Healthy function for checking whether replica is in rotation
+func (r *Replica) Healthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// start function for running periodic health checks
+func (rs *ReplicaSet) start() {
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		ticker := time.NewTicker(rs.cfg.HealthCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rs.stop:
+				return
+			case <-ticker.C:
+				rs.CheckHealth(context.Background())
+			}
+		}
+	}()
+}
+
+// Close function for stopping health checks and closing replica connections, the primary is left open,
+// replicas are taken out of rotation before they are closed so Get returns the primary from then on
+func (rs *ReplicaSet) Close() error {
+	rs.stopOnce.Do(func() {
+		close(rs.stop)
+	})
+	rs.wg.Wait()
+
+	rs.mu.Lock()
+	replicas := rs.replicas
+	rs.replicas = nil
+	for _, r := range replicas {
+		atomic.StoreInt32(&r.healthy, 0)
+	}
+	rs.mu.Unlock()
+
+	var errs []error
+	for _, r := range replicas {
+		r.mu.Lock()
+		if r.DB != nil {
+			if err := r.DB.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		r.mu.Unlock()
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// GetReadReplicaSet function to get read replicas configured by DBR_HOSTS, with GetWriteDB as fallback
+func GetReadReplicaSet() (*ReplicaSet, error) {
+	readReplicasMu.Lock()
+	defer readReplicasMu.Unlock()
+
+	if readReplicas != nil {
+		return readReplicas, nil
+	}
+
+	cfg, err := ReplicaSetConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	rs, err := NewReplicaSet(context.Background(), cfg, GetWriteDB())
+	if err != nil {
+		return nil, err
+	}
+	readReplicas = rs
+	return rs, nil
+}
+
+// closeReadReplicaSet function for closing replicas created by GetReadReplicaSet
+func closeReadReplicaSet() {
+	readReplicasMu.Lock()
+	defer readReplicasMu.Unlock()
+
+	if readReplicas != nil {
+		readReplicas.Close()
+		readReplicas = nil
+	}
+}
@@ -0,0 +1,169 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+func newMockGormDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	mock.ExpectPing()
+	db, err := gorm.Open("postgres", sqlDB)
+	assert.NoError(t, err)
+	return db, mock
+}
+
+func TestReplicaSet(t *testing.T) {
+	primary, _ := newMockGormDB(t)
+	replicaA, mockA := newMockGormDB(t)
+	replicaB, mockB := newMockGormDB(t)
+
+	rs := newReplicaSet(ReplicaSetConfig{MaxLag: time.Second}, primary)
+	rs.AddReplica("a", replicaA)
+	rs.AddReplica("b", replicaB)
+
+	t.Run("ROUND ROBIN Get", func(t *testing.T) {
+		assert.Equal(t, "a", rs.Get().Name)
+		assert.Equal(t, "b", rs.Get().Name)
+		assert.Equal(t, "a", rs.Get().Name)
+	})
+
+	t.Run("EJECT LAGGING CheckHealth", func(t *testing.T) {
+		mockA.ExpectPing()
+		mockA.ExpectQuery(`WHEN pg_last_wal_receive_lsn\(\) = pg_last_wal_replay_lsn\(\) THEN 0`).WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0.5))
+		mockB.ExpectPing()
+		mockB.ExpectQuery("pg_last_xact_replay_timestamp").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(30.0))
+		rs.CheckHealth(context.Background())
+
+		assert.Equal(t, "a", rs.Get().Name)
+		assert.Equal(t, "a", rs.Get().Name)
+		status := rs.Status()
+		assert.True(t, status[0].Healthy)
+		assert.False(t, status[1].Healthy)
+		assert.Contains(t, status[1].LastError, "replication lag")
+	})
+
+	t.Run("FALLBACK PRIMARY CheckHealth", func(t *testing.T) {
+		mockA.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mockB.ExpectPing().WillReturnError(errors.New("connection refused"))
+		rs.CheckHealth(context.Background())
+
+		r := rs.Get()
+		assert.Equal(t, PrimaryReplicaName, r.Name)
+		assert.Equal(t, primary, r.DB)
+	})
+
+	t.Run("RECOVER CheckHealth", func(t *testing.T) {
+		mockA.ExpectPing().WillReturnError(errors.New("connection refused"))
+		mockB.ExpectPing()
+		mockB.ExpectQuery("pg_last_xact_replay_timestamp").WillReturnRows(sqlmock.NewRows([]string{"lag"}).AddRow(0))
+		rs.CheckHealth(context.Background())
+
+		ctx, db := rs.GetContext(context.Background())
+		assert.True(t, replicaB.DB() == db.DB())
+		assert.Equal(t, ctx, DBContext(db))
+		assert.Equal(t, "b", ReplicaFromContext(ctx))
+		assert.Equal(t, "b", LogFieldsFromContext(ctx)["db_replica"])
+	})
+
+	t.Run("LEAST CONNECTIONS Get", func(t *testing.T) {
+		lc := newReplicaSet(ReplicaSetConfig{Balance: ReplicaLeastConnections}, primary)
+		lc.AddReplica("a", replicaA)
+		lc.AddReplica("b", replicaB)
+		assert.Equal(t, "a", lc.Get().Name)
+	})
+
+	t.Run("OUT OF ROTATION Close", func(t *testing.T) {
+		replicas := append([]*Replica(nil), rs.replicas...)
+		mockA.ExpectClose()
+		mockB.ExpectClose()
+		assert.NoError(t, rs.Close())
+
+		assert.Equal(t, PrimaryReplicaName, rs.Get().Name)
+		assert.Empty(t, rs.Status())
+		for _, r := range replicas {
+			assert.False(t, r.Healthy())
+		}
+		assert.NoError(t, mockA.ExpectationsWereMet())
+		assert.NoError(t, mockB.ExpectationsWereMet())
+	})
+}
+
+func TestReplicaSetConfigFromEnv(t *testing.T) {
+	t.Run("SUCCESS ReplicaSetConfigFromEnv", func(t *testing.T) {
+		os.Setenv("DBR_HOSTS", "replica-1, replica-2:6432")
+		os.Setenv("DBR_BALANCE", "least_connections")
+		os.Setenv("DBR_MAX_LAG_SECONDS", "5")
+		defer os.Unsetenv("DBR_HOSTS")
+		defer os.Unsetenv("DBR_BALANCE")
+		defer os.Unsetenv("DBR_MAX_LAG_SECONDS")
+
+		cfg, err := ReplicaSetConfigFromEnv()
+		assert.NoError(t, err)
+		assert.Len(t, cfg.Nodes, 2)
+		assert.Equal(t, "replica-1", cfg.Nodes[0].Host)
+		assert.Equal(t, DefaultDBPort, cfg.Nodes[0].Port)
+		assert.Equal(t, 6432, cfg.Nodes[1].Port)
+		assert.Equal(t, ReplicaLeastConnections, cfg.Balance)
+		assert.Equal(t, 5*time.Second, cfg.MaxLag)
+	})
+
+	t.Run("IPV6 ReplicaSetConfigFromEnv", func(t *testing.T) {
+		os.Setenv("DBR_HOSTS", "[fd00::1]:6432,[fd00::2],fd00::3")
+		defer os.Unsetenv("DBR_HOSTS")
+
+		cfg, err := ReplicaSetConfigFromEnv()
+		assert.NoError(t, err)
+		assert.Len(t, cfg.Nodes, 3)
+		assert.Equal(t, "fd00::1", cfg.Nodes[0].Host)
+		assert.Equal(t, 6432, cfg.Nodes[0].Port)
+		assert.Equal(t, "fd00::2", cfg.Nodes[1].Host)
+		assert.Equal(t, DefaultDBPort, cfg.Nodes[1].Port)
+		assert.Equal(t, "fd00::3", cfg.Nodes[2].Host)
+		assert.Equal(t, "[fd00::1]:6432", replicaName(cfg.Nodes[0]))
+	})
+
+	t.Run("INVALID PORT ReplicaSetConfigFromEnv", func(t *testing.T) {
+		os.Setenv("DBR_HOSTS", "replica-1:abc")
+		defer os.Unsetenv("DBR_HOSTS")
+
+		_, err := ReplicaSetConfigFromEnv()
+		assert.Error(t, err)
+	})
+}
+
+func TestNewReplicaSet(t *testing.T) {
+	t.Run("DEAD REPLICA NewReplicaSet", func(t *testing.T) {
+		primary, _ := newMockGormDB(t)
+		dead := NewSQLiteDBConfig("/golib-missing-dir/replica.db")
+		start := time.Now()
+		rs, err := NewReplicaSet(context.Background(), ReplicaSetConfig{
+			Nodes:               []DBConfig{dead, dead, NewSQLiteDBConfig(SQLiteMemory)},
+			HealthCheckInterval: time.Hour,
+			HealthCheckTimeout:  time.Second,
+		}, primary)
+		assert.NoError(t, err)
+		defer rs.Close()
+
+		assert.True(t, time.Since(start) < 2*time.Second)
+		status := rs.Status()
+		assert.False(t, status[0].Healthy)
+		assert.NotEmpty(t, status[0].LastError)
+		assert.False(t, status[1].Healthy)
+		assert.True(t, status[2].Healthy)
+		assert.NotEqual(t, PrimaryReplicaName, rs.Get().Name)
+	})
+
+	t.Run("ERROR NewReplicaSet", func(t *testing.T) {
+		_, err := NewReplicaSet(context.Background(), ReplicaSetConfig{}, nil)
+		assert.Error(t, err)
+	})
+}
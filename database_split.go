@@ -0,0 +1,219 @@
+package golib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// primaryHint comment prefixed to statements which must run on the write pool
+const primaryHint = "/* golib:primary */ "
+
+var (
+	dbSplit   *gorm.DB
+	dbSplitMu sync.Mutex
+)
+
+// primaryKey context key forcing the write pool
+type primaryKey struct{}
+
+// WithPrimary function for forcing queries of ctx to the write pool, used to read your own writes
+// right after a mutation in the same request
+// ctx context.Context
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// IsPrimaryForced function for checking whether ctx forces the write pool
+func IsPrimaryForced(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	forced, _ := ctx.Value(primaryKey{}).(bool)
+	return forced
+}
+
+// dbRouter connection sending SELECT statements to the read pool and every other statement,
+// prepared statement and transaction to the write pool
+type dbRouter struct {
+	write         func() *sql.DB
+	read          func() *sql.DB
+	writeInstance string
+}
+
+// route function for getting role and instance of the pool running statement,
+// reported by tracing and query log so they match the pool chosen by pick
+func (r *dbRouter) route(query string) (role, instance string) {
+	if isReadStatement(query) {
+		return DBRoleRead, ""
+	}
+	return DBRoleWrite, r.writeInstance
+}
+
+// pick function for getting pool of statement
+func (r *dbRouter) pick(query string) *sql.DB {
+	if role, _ := r.route(query); role == DBRoleRead {
+		return r.read()
+	}
+	return r.write()
+}
+
+// Exec function for executing statement on the write pool
+func (r *dbRouter) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.write().Exec(query, args...)
+}
+
+// Prepare function for preparing statement on the write pool
+func (r *dbRouter) Prepare(query string) (*sql.Stmt, error) {
+	return r.write().Prepare(query)
+}
+
+// Query function for running statement on the pool of statement
+func (r *dbRouter) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.pick(query).Query(query, args...)
+}
+
+// QueryRow function for running statement on the pool of statement
+func (r *dbRouter) QueryRow(query string, args ...interface{}) *sql.Row {
+	return r.pick(query).QueryRow(query, args...)
+}
+
+// Begin function for starting transaction on the write pool
+func (r *dbRouter) Begin() (*sql.Tx, error) {
+	return r.write().Begin()
+}
+
+// BeginTx function for starting transaction on the write pool
+func (r *dbRouter) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return r.write().BeginTx(ctx, opts)
+}
+
+// Close function for closing router, the pools are owned by their own handles and stay open
+func (r *dbRouter) Close() error {
+	return nil
+}
+
+// isReadStatement function for checking whether statement is a SELECT without row locks and without the primary hint
+func isReadStatement(query string) bool {
+	if strings.HasPrefix(query, primaryHint) {
+		return false
+	}
+
+	q := strings.TrimSpace(query)
+	for strings.HasPrefix(q, "/*") {
+		end := strings.Index(q, "*/")
+		if end < 0 {
+			return false
+		}
+		q = strings.TrimSpace(q[end+2:])
+	}
+	if len(q) < 6 || !strings.EqualFold(q[:6], "SELECT") {
+		return false
+	}
+
+	upper := strings.ToUpper(q)
+	for _, lock := range []string{"FOR UPDATE", "FOR SHARE", "FOR NO KEY UPDATE", "FOR KEY SHARE", "LOCK IN SHARE MODE"} {
+		if strings.Contains(upper, lock) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewReadWriteDB function for creating single handle whose SELECT statements run on read and every other
+// statement on write, transactions stay on write and WithPrimary forces write for a context attached by DBWithContext,
+// closing the handle leaves write and read open,
+// DB() of the returned handle panics because gorm requires a single *sql.DB, use ReadWritePools for pool settings and statistics
+// write *gorm.DB
+// read func() *gorm.DB called for every SELECT so a replica set may balance them
+func NewReadWriteDB(write *gorm.DB, read func() *gorm.DB) (*gorm.DB, error) {
+	if write == nil || read == nil {
+		return nil, errors.New("read write database requires write and read databases")
+	}
+
+	instance := PrimaryReplicaName
+	if v, ok := write.Get(dbInstanceKey); ok {
+		instance, _ = v.(string)
+	}
+	router := &dbRouter{
+		write: write.DB,
+		read: func() *sql.DB {
+			return read().DB()
+		},
+		writeInstance: instance,
+	}
+	db, err := gorm.Open(write.Dialect().GetName(), router)
+	if err != nil {
+		return nil, err
+	}
+
+	RegisterTracingCallbacks(db)
+	RegisterQueryLogCallbacks(db)
+	RegisterReadWriteCallbacks(db)
+	enableStatementLogger(db)
+	// statements outside transactions report the pool chosen by the router, transactions run on write
+	return withDBRole(db, DBRoleWrite, instance), nil
+}
+
+// ReadWritePools function for getting write pool and current read pool of handle created by NewReadWriteDB,
+// ok is false for any other handle
+// db *gorm.DB
+func ReadWritePools(db *gorm.DB) (write, read *sql.DB, ok bool) {
+	if db == nil {
+		return nil, nil, false
+	}
+	r, ok := db.CommonDB().(*dbRouter)
+	if !ok {
+		return nil, nil, false
+	}
+	return r.write(), r.read(), true
+}
+
+// RegisterReadWriteCallbacks function for registering gorm callbacks sending queries of handles created by
+// NewReadWriteDB to the write pool when their context is forced by WithPrimary
+// db *gorm.DB
+func RegisterReadWriteCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	if cb.Query().Get("golib:route_query") != nil {
+		return
+	}
+
+	cb.Query().Before("gorm:query").Register("golib:route_query", routeQuery)
+	cb.RowQuery().Before("gorm:row_query").Register("golib:route_row_query", routeQuery)
+}
+
+// routeQuery callback prefixing primary hint to query of forced context
+func routeQuery(scope *gorm.Scope) {
+	if _, ok := scope.SQLDB().(*dbRouter); !ok {
+		return
+	}
+	if !IsPrimaryForced(TxContext(scope.DB())) {
+		return
+	}
+
+	hint := primaryHint
+	if v, ok := scope.Get("gorm:query_hint"); ok {
+		hint += fmt.Sprint(v)
+	}
+	scope.Set("gorm:query_hint", hint)
+}
+
+// GetReadWriteDB function to get single database handle splitting reads to GetReadDB and writes to GetWriteDB
+func GetReadWriteDB() *gorm.DB {
+	dbSplitMu.Lock()
+	defer dbSplitMu.Unlock()
+
+	if dbSplit == nil {
+		db, err := NewReadWriteDB(GetWriteDB(), GetReadDB)
+		if err != nil {
+			panic(err)
+		}
+		dbSplit = db
+	}
+	return dbSplit
+}
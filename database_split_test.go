@@ -0,0 +1,160 @@
+package golib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+type splitOrder struct {
+	ID   uint
+	Code string
+}
+
+func newMockReadWriteDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock, sqlmock.Sqlmock) {
+	write, writeMock := newMockGormDB(t)
+	read, readMock := newMockGormDB(t)
+	db, err := NewReadWriteDB(write, func() *gorm.DB { return read })
+	assert.NoError(t, err)
+	return db, writeMock, readMock
+}
+
+func TestIsReadStatement(t *testing.T) {
+	t.Run("SUCCESS isReadStatement", func(t *testing.T) {
+		for query, read := range map[string]bool{
+			`SELECT * FROM "orders"`:                          true,
+			` /* report */ select count(*) FROM "orders"`:     true,
+			`SELECT * FROM "orders" FOR UPDATE`:               false,
+			primaryHint + `SELECT * FROM "orders"`:            false,
+			`INSERT INTO "orders" ("code") VALUES ($1)`:       false,
+			`WITH d AS (DELETE FROM "orders") SELECT 1`:       false,
+			`/* unterminated SELECT * FROM "orders"`:          false,
+			`UPDATE "orders" SET "code" = $1 WHERE "id" = $2`: false,
+		} {
+			assert.Equal(t, read, isReadStatement(query), query)
+		}
+	})
+}
+
+func TestNewReadWriteDB(t *testing.T) {
+	t.Run("SELECT ON READ NewReadWriteDB", func(t *testing.T) {
+		db, writeMock, readMock := newMockReadWriteDB(t)
+		readMock.ExpectQuery(`SELECT \* FROM "split_orders"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(1, "ORD-1"))
+
+		var orders []splitOrder
+		assert.NoError(t, db.Find(&orders).Error)
+		assert.Len(t, orders, 1)
+		assert.NoError(t, readMock.ExpectationsWereMet())
+		assert.NoError(t, writeMock.ExpectationsWereMet())
+	})
+
+	t.Run("WRITE ON PRIMARY NewReadWriteDB", func(t *testing.T) {
+		db, writeMock, readMock := newMockReadWriteDB(t)
+		writeMock.ExpectBegin()
+		writeMock.ExpectQuery(`INSERT INTO "split_orders"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		writeMock.ExpectCommit()
+		writeMock.ExpectExec(`DELETE FROM "split_orders"`).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		assert.NoError(t, db.Create(&splitOrder{Code: "ORD-1"}).Error)
+		assert.NoError(t, db.Exec(`DELETE FROM "split_orders"`).Error)
+		assert.NoError(t, writeMock.ExpectationsWereMet())
+		assert.NoError(t, readMock.ExpectationsWereMet())
+	})
+
+	t.Run("TRANSACTION ON PRIMARY NewReadWriteDB", func(t *testing.T) {
+		db, writeMock, readMock := newMockReadWriteDB(t)
+		writeMock.ExpectBegin()
+		writeMock.ExpectQuery(`SELECT \* FROM "split_orders"`).WillReturnRows(sqlmock.NewRows([]string{"id", "code"}))
+		writeMock.ExpectCommit()
+
+		err := WithTransactionDB(context.Background(), db, func(tx *gorm.DB) error {
+			var orders []splitOrder
+			return tx.Find(&orders).Error
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, writeMock.ExpectationsWereMet())
+		assert.NoError(t, readMock.ExpectationsWereMet())
+	})
+
+	t.Run("FORCED PRIMARY NewReadWriteDB", func(t *testing.T) {
+		db, writeMock, readMock := newMockReadWriteDB(t)
+		writeMock.ExpectQuery(`/\* golib:primary \*/ SELECT \* FROM "split_orders"`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "code"}).AddRow(1, "ORD-1"))
+		readMock.ExpectQuery(`^SELECT count\(\*\) FROM "split_orders"`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		ctx := WithPrimary(context.Background())
+		var order splitOrder
+		assert.NoError(t, DBWithContext(ctx, db).First(&order).Error)
+		assert.Equal(t, "ORD-1", order.Code)
+
+		var count int
+		assert.NoError(t, DBWithContext(context.Background(), db).Model(&splitOrder{}).Count(&count).Error)
+		assert.Equal(t, 1, count)
+		assert.NoError(t, writeMock.ExpectationsWereMet())
+		assert.NoError(t, readMock.ExpectationsWereMet())
+	})
+
+	t.Run("ROLE OF POOL NewReadWriteDB", func(t *testing.T) {
+		db, writeMock, readMock := newMockReadWriteDB(t)
+		tracer := mocktracer.New()
+		ctx := opentracing.ContextWithSpan(context.Background(), tracer.StartSpan("http"))
+		readMock.ExpectQuery(`SELECT \* FROM "split_orders"`).WillReturnRows(sqlmock.NewRows([]string{"id", "code"}))
+		writeMock.ExpectBegin()
+		writeMock.ExpectQuery(`INSERT INTO "split_orders"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		writeMock.ExpectCommit()
+
+		var orders []splitOrder
+		assert.NoError(t, DBWithContext(ctx, db).Find(&orders).Error)
+		assert.NoError(t, DBWithContext(ctx, db).Create(&splitOrder{Code: "ORD-1"}).Error)
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 2)
+		assert.Equal(t, DBRoleRead, spans[0].Tag("db.role"))
+		assert.Nil(t, spans[0].Tag("db.instance"))
+		assert.Equal(t, DBRoleWrite, spans[1].Tag("db.role"))
+		assert.Equal(t, PrimaryReplicaName, spans[1].Tag("db.instance"))
+	})
+
+	t.Run("ERROR NewReadWriteDB", func(t *testing.T) {
+		_, err := NewReadWriteDB(nil, nil)
+		assert.Error(t, err)
+	})
+}
+
+func TestReadWritePools(t *testing.T) {
+	t.Run("SUCCESS ReadWritePools", func(t *testing.T) {
+		write, _ := newMockGormDB(t)
+		read, _ := newMockGormDB(t)
+		db, err := NewReadWriteDB(write, func() *gorm.DB { return read })
+		assert.NoError(t, err)
+
+		writePool, readPool, ok := ReadWritePools(db)
+		assert.True(t, ok)
+		assert.Equal(t, write.DB(), writePool)
+		assert.Equal(t, read.DB(), readPool)
+		assert.Equal(t, 0, writePool.Stats().InUse)
+		assert.Panics(t, func() { db.DB() })
+	})
+
+	t.Run("NOT READ WRITE ReadWritePools", func(t *testing.T) {
+		db, _ := newMockGormDB(t)
+		_, _, ok := ReadWritePools(db)
+		assert.False(t, ok)
+		_, _, ok = ReadWritePools(nil)
+		assert.False(t, ok)
+	})
+}
+
+func TestWithPrimary(t *testing.T) {
+	t.Run("SUCCESS WithPrimary", func(t *testing.T) {
+		assert.False(t, IsPrimaryForced(context.Background()))
+		assert.True(t, IsPrimaryForced(WithPrimary(context.Background())))
+	})
+}
@@ -1,8 +1,10 @@
 package golib
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jinzhu/gorm"
@@ -26,16 +28,24 @@ func TestDBLogFormatter_Format(t *testing.T) {
 }
 
 func TestInitDB(t *testing.T) {
-	t.Run("PANIC InitDB", func(t *testing.T) {
-		os.Setenv("DEBUG", "1")
-
-		defer func() {
-			if r := recover(); r == nil {
-				t.Errorf("The code did not panic")
-			}
-		}()
+	defer SetDBQueryLog(DBQueryLogConfig{})
+	defer setDBQueryLogOutput(nil)
 
-		InitDB()
+	t.Run("FALLBACK InitDB", func(t *testing.T) {
+		os.Setenv("DEBUG", "1")
+		os.Setenv("DB_SLOW_QUERY_MS", "200")
+		defer os.Setenv("DB_SLOW_QUERY_MS", "")
+		storageDir := os.Getenv("STORAGE_DIR")
+		dir, _ := ioutil.TempDir("", "golib")
+		defer os.RemoveAll(dir)
+		os.Setenv("STORAGE_DIR", dir)
+		defer os.Setenv("STORAGE_DIR", storageDir)
+
+		assert.NotPanics(t, InitDB)
+		cfg, out := getDBQueryLog()
+		assert.True(t, cfg.LogAll)
+		assert.Equal(t, 200*time.Millisecond, cfg.SlowThreshold)
+		assert.Nil(t, out)
 	})
 }
 
@@ -87,6 +97,30 @@ func TestGetReadDB(t *testing.T) {
 	})
 }
 
+func TestSQLiteDB(t *testing.T) {
+	t.Run("SUCCESS SQLITE GetWriteDB GetReadDB", func(t *testing.T) {
+		CloseDb()
+		for _, prefix := range []string{"DBW", "DBR"} {
+			os.Setenv(prefix+"_DIALECT", string(DBDialectSQLite))
+			os.Setenv(prefix+"_NAME", SQLiteMemory)
+			defer os.Unsetenv(prefix + "_DIALECT")
+			defer os.Unsetenv(prefix + "_NAME")
+		}
+		defer CloseDb()
+
+		type memoryOrder struct {
+			ID   uint
+			Code string
+		}
+		assert.NoError(t, GetWriteDB().AutoMigrate(&memoryOrder{}).Error)
+		assert.NoError(t, GetWriteDB().Create(&memoryOrder{Code: "ORD-1"}).Error)
+
+		var order memoryOrder
+		assert.NoError(t, GetReadDB().Where("code = ?", "ORD-1").First(&order).Error)
+		assert.Equal(t, "ORD-1", order.Code)
+	})
+}
+
 func TestCloseDb(t *testing.T) {
 
 	t.Run("SUCCESS CLOSE DB", func(t *testing.T) {
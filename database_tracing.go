@@ -0,0 +1,176 @@
+package golib
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+)
+
+const (
+	// DBRoleWrite role of write connection
+	DBRoleWrite = "write"
+	// DBRoleRead role of read connection
+	DBRoleRead = "read"
+
+	// dbRoleKey gorm setting holding role of the connection
+	dbRoleKey = "golib:db_role"
+	// dbInstanceKey gorm setting holding name of the connection
+	dbInstanceKey = "golib:db_instance"
+	// dbSpanKey scope instance setting holding span of the running operation
+	dbSpanKey = "golib:span"
+)
+
+// sqlLiteralRegexp string and numeric literals masked in db.statement, placeholders such as $1 are kept
+var sqlLiteralRegexp = regexp.MustCompile(`'(?:[^']|'')*'|(?:^|[^$\w.])\d+(?:\.\d+)?\b`)
+
+// DBWithContext function for attaching ctx to db, gorm operations of the returned db
+// open child spans of the span carried by ctx
+// ctx context.Context carrying the parent span
+// db *gorm.DB
+func DBWithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	return withStatementLogger(db.Set(dbContextKey, ctx))
+}
+
+// DBContext function for getting context attached by DBWithContext or WithTransaction
+func DBContext(db *gorm.DB) context.Context {
+	return TxContext(db)
+}
+
+// withDBRole function for marking connection as read or write connection, reported by db.role span tag
+func withDBRole(db *gorm.DB, role, instance string) *gorm.DB {
+	if db == nil {
+		return nil
+	}
+	return withStatementLogger(db.Set(dbRoleKey, role).Set(dbInstanceKey, instance))
+}
+
+// scopeDBRole function for getting role and instance of the connection which ran statement of scope,
+// statements of handles created by NewReadWriteDB report the pool chosen for them,
+// role is empty for connections which are not marked by withDBRole
+func scopeDBRole(scope *gorm.Scope) (role, instance string) {
+	if r, ok := scope.SQLDB().(*dbRouter); ok {
+		return r.route(scope.SQL)
+	}
+
+	if v, ok := scope.Get(dbRoleKey); ok {
+		role, _ = v.(string)
+	}
+	if v, ok := scope.Get(dbInstanceKey); ok {
+		instance, _ = v.(string)
+	}
+	return role, instance
+}
+
+// RegisterTracingCallbacks function for registering gorm callbacks opening a span for every
+// create, query, update, delete and raw row query whose db carries a context with a span,
+// Exec of golib connections runs without callbacks and is traced by their gorm logger (see traceStatement)
+// db *gorm.DB
+func RegisterTracingCallbacks(db *gorm.DB) {
+	cb := db.Callback()
+	if cb.Create().Get("golib:trace_before_create") != nil {
+		return
+	}
+
+	cb.Create().Before("gorm:begin_transaction").Register("golib:trace_before_create", traceBefore("db.create"))
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("golib:trace_after_create", traceAfter)
+	cb.Update().Before("gorm:begin_transaction").Register("golib:trace_before_update", traceBefore("db.update"))
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("golib:trace_after_update", traceAfter)
+	cb.Delete().Before("gorm:begin_transaction").Register("golib:trace_before_delete", traceBefore("db.delete"))
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("golib:trace_after_delete", traceAfter)
+	cb.Query().Before("gorm:query").Register("golib:trace_before_query", traceBefore("db.query"))
+	cb.Query().After("gorm:after_query").Register("golib:trace_after_query", traceAfter)
+	cb.RowQuery().Before("gorm:row_query").Register("golib:trace_before_row_query", traceBefore("db.raw"))
+	cb.RowQuery().After("gorm:row_query").Register("golib:trace_after_row_query", traceAfter)
+}
+
+// traceBefore function for getting callback opening span of operation
+func traceBefore(operation string) func(scope *gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.Get(dbContextKey)
+		if !ok {
+			return
+		}
+		ctx, _ := v.(context.Context)
+		if ctx == nil {
+			return
+		}
+		parent := opentracing.SpanFromContext(ctx)
+		if parent == nil {
+			return
+		}
+
+		span := parent.Tracer().StartSpan(operation, opentracing.ChildOf(parent.Context()))
+		ext.SpanKindRPCClient.Set(span)
+		ext.DBType.Set(span, "sql")
+
+		scope.InstanceSet(dbSpanKey, span)
+	}
+}
+
+// traceAfter callback finishing span of operation
+func traceAfter(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet(dbSpanKey)
+	if !ok {
+		return
+	}
+	span := v.(opentracing.Span)
+	defer span.Finish()
+
+	ext.DBStatement.Set(span, maskSQL(scope.SQL))
+	role, instance := scopeDBRole(scope)
+	setDBRoleTags(span, role, instance)
+	if table := scope.TableName(); table != "" {
+		span.SetTag("db.table", table)
+	}
+	span.SetTag("db.rows_affected", scope.DB().RowsAffected)
+
+	if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		ext.Error.Set(span, true)
+		span.LogKV("event", "error", "error.object", err)
+	}
+}
+
+// traceStatement function for recording span of statement which gorm ran without callbacks such as db.Exec,
+// the span starts retroactively because gorm reports the statement once it finished
+func traceStatement(ctx context.Context, statement string, duration time.Duration, rows int64, role, instance string) {
+	if ctx == nil {
+		return
+	}
+	parent := opentracing.SpanFromContext(ctx)
+	if parent == nil {
+		return
+	}
+
+	span := parent.Tracer().StartSpan("db.exec", opentracing.ChildOf(parent.Context()), opentracing.StartTime(time.Now().Add(-duration)))
+	defer span.Finish()
+
+	ext.SpanKindRPCClient.Set(span)
+	ext.DBType.Set(span, "sql")
+	ext.DBStatement.Set(span, maskSQL(statement))
+	setDBRoleTags(span, role, instance)
+	span.SetTag("db.rows_affected", rows)
+}
+
+// setDBRoleTags function for tagging span with role and instance of the connection when they are known
+func setDBRoleTags(span opentracing.Span, role, instance string) {
+	if role != "" {
+		span.SetTag("db.role", role)
+	}
+	if instance != "" {
+		ext.DBInstance.Set(span, instance)
+	}
+}
+
+// maskSQL function for masking literal values of statement, bound parameters are already placeholders
+func maskSQL(statement string) string {
+	return sqlLiteralRegexp.ReplaceAllStringFunc(statement, func(m string) string {
+		if m[0] == '\'' || (m[0] >= '0' && m[0] <= '9') {
+			return "?"
+		}
+		return m[:1] + "?"
+	})
+}
@@ -0,0 +1,103 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+)
+
+type tracedOrder struct {
+	ID     int
+	Status string
+}
+
+func TestRegisterTracingCallbacks(t *testing.T) {
+	db, mock := newMockGormDB(t)
+	RegisterTracingCallbacks(db)
+	RegisterTracingCallbacks(db)
+
+	tracer := mocktracer.New()
+	parent := tracer.StartSpan("http")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	t.Run("QUERY RegisterTracingCallbacks", func(t *testing.T) {
+		tracer.Reset()
+		mock.ExpectQuery(`SELECT \* FROM "traced_orders"`).WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "paid"))
+
+		var orders []tracedOrder
+		assert.NoError(t, DBWithContext(ctx, withDBRole(db, DBRoleRead, "replica-1")).Where("status = 'paid'").Find(&orders).Error)
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 1)
+		span := spans[0]
+		assert.Equal(t, "db.query", span.OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, span.ParentID)
+		assert.Equal(t, "traced_orders", span.Tag("db.table"))
+		assert.Equal(t, "read", span.Tag("db.role"))
+		assert.Equal(t, "replica-1", span.Tag("db.instance"))
+		assert.Equal(t, `SELECT * FROM "traced_orders"  WHERE (status = ?)`, span.Tag("db.statement"))
+		assert.Equal(t, int64(1), span.Tag("db.rows_affected"))
+	})
+
+	t.Run("ERROR RegisterTracingCallbacks", func(t *testing.T) {
+		tracer.Reset()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO "traced_orders"`).WillReturnError(errors.New("duplicate key"))
+		mock.ExpectRollback()
+
+		assert.Error(t, DBWithContext(ctx, db).Create(&tracedOrder{Status: "new"}).Error)
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 1)
+		assert.Equal(t, "db.create", spans[0].OperationName)
+		assert.Equal(t, true, spans[0].Tag("error"))
+		assert.Nil(t, spans[0].Tag("db.role"))
+	})
+
+	t.Run("EXEC RegisterTracingCallbacks", func(t *testing.T) {
+		tracer.Reset()
+		traced, traceMock := newMockGormDB(t)
+		configureDB(traced, DBPoolConfig{})
+		traceMock.ExpectExec(`UPDATE orders SET status = 'paid' WHERE id = 7`).WillReturnResult(sqlmock.NewResult(0, 1))
+		traceMock.ExpectBegin()
+		traceMock.ExpectExec(`UPDATE "traced_orders"`).WillReturnResult(sqlmock.NewResult(0, 1))
+		traceMock.ExpectCommit()
+
+		txDB := DBWithContext(ctx, withDBRole(traced, DBRoleWrite, PrimaryReplicaName))
+		assert.NoError(t, txDB.Exec(`UPDATE orders SET status = 'paid' WHERE id = 7`).Error)
+		assert.NoError(t, txDB.Model(&tracedOrder{ID: 1}).Update("status", "paid").Error)
+		assert.NoError(t, traceMock.ExpectationsWereMet())
+
+		spans := tracer.FinishedSpans()
+		assert.Len(t, spans, 2)
+		span := spans[0]
+		assert.Equal(t, "db.exec", span.OperationName)
+		assert.Equal(t, parent.Context().(mocktracer.MockSpanContext).SpanID, span.ParentID)
+		assert.Equal(t, `UPDATE orders SET status = ? WHERE id = ?`, span.Tag("db.statement"))
+		assert.Equal(t, DBRoleWrite, span.Tag("db.role"))
+		assert.Equal(t, PrimaryReplicaName, span.Tag("db.instance"))
+		assert.Equal(t, int64(1), span.Tag("db.rows_affected"))
+		assert.Equal(t, "db.update", spans[1].OperationName)
+	})
+
+	t.Run("NO PARENT RegisterTracingCallbacks", func(t *testing.T) {
+		tracer.Reset()
+		mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		var orders []tracedOrder
+		assert.NoError(t, db.Find(&orders).Error)
+		assert.Empty(t, tracer.FinishedSpans())
+	})
+}
+
+func TestMaskSQL(t *testing.T) {
+	t.Run("SUCCESS maskSQL", func(t *testing.T) {
+		assert.Equal(t, `SELECT * FROM t1 WHERE a = $1 AND b = ? AND c IN (?, ?) AND d = ?`,
+			maskSQL(`SELECT * FROM t1 WHERE a = $1 AND b = 'it''s' AND c IN (10, 2.5) AND d = 3`))
+	})
+}
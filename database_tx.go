@@ -0,0 +1,223 @@
+package golib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	// dbContextKey gorm setting holding context of the transaction
+	dbContextKey = "golib:context"
+
+	// SQLStateSerializationFailure postgres serialization failure
+	SQLStateSerializationFailure = "40001"
+	// SQLStateDeadlockDetected postgres deadlock
+	SQLStateDeadlockDetected = "40P01"
+
+	// DefaultTxMaxRetries retries of transaction failing with serialization failure or deadlock
+	DefaultTxMaxRetries = 3
+)
+
+// TxOptions options of WithTransaction
+type TxOptions struct {
+	// Isolation isolation level, default of the database when zero
+	Isolation sql.IsolationLevel
+	// ReadOnly read only transaction
+	ReadOnly bool
+	// MaxRetries retries on serialization failure or deadlock, zero uses DefaultTxMaxRetries, negative disables retries
+	MaxRetries int
+	// RetryBackoff wait before the first retry, doubled on every retry, default 50ms
+	RetryBackoff time.Duration
+}
+
+// txKey context key of the running transaction
+type txKey struct{}
+
+// savepointSeq sequence of savepoint names
+var savepointSeq uint64
+
+// WithTransaction function for running fn inside transaction of GetWriteDB,
+// fn runs inside a savepoint when ctx already carries a transaction, such as TxContext(tx) of a running tx
+// ctx context.Context
+// fn func(tx *gorm.DB) error committed when it returns nil, rolled back on error or panic,
+// TxContext(tx) gives its context, WithTransaction called with it nests
+// opts ...TxOptions
+func WithTransaction(ctx context.Context, fn func(tx *gorm.DB) error, opts ...TxOptions) error {
+	db := TxFromContext(ctx)
+	if db == nil {
+		db = GetWriteDB()
+	}
+	return WithTransactionDB(ctx, db, fn, opts...)
+}
+
+// WithTransactionDB function for running fn inside transaction of db,
+// fn runs inside a savepoint when db is already a transaction,
+// top level transactions are retried on serialization failures and deadlocks
+// ctx context.Context
+// db *gorm.DB database or running transaction
+// fn func(tx *gorm.DB) error committed when it returns nil, rolled back on error or panic,
+// TxContext(tx) gives its context, WithTransaction called with it nests
+// opts ...TxOptions
+func WithTransactionDB(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error, opts ...TxOptions) error {
+	if db == nil {
+		return errors.New("transaction requires a database")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var o TxOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return runSavepoint(ctx, db, fn)
+	}
+
+	if o.MaxRetries == 0 {
+		o.MaxRetries = DefaultTxMaxRetries
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 50 * time.Millisecond
+	}
+	backoff := DBRetryConfig{InitialBackoff: o.RetryBackoff, MaxBackoff: 20 * o.RetryBackoff}
+
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, db, fn, o)
+		if err == nil || !IsRetryableTxError(err) || attempt > o.MaxRetries {
+			return err
+		}
+
+		wait := backoff.backoff(attempt)
+		LogCtx(ctx, WarnLevel, fmt.Sprintf("transaction attempt %d failed, retrying in %s", attempt, wait), "database", "transaction",
+			map[string]interface{}{"attempt": attempt, "error": err.Error()})
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// runTx function for running fn inside a new transaction
+func runTx(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error, o TxOptions) (err error) {
+	tx := db.BeginTx(ctx, &sql.TxOptions{Isolation: o.Isolation, ReadOnly: o.ReadOnly})
+	if tx.Error != nil {
+		return tx.Error
+	}
+	ctx = context.WithValue(ctx, txKey{}, tx)
+	tx = DBWithContext(ctx, tx)
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// runSavepoint function for running fn inside a savepoint of running transaction
+func runSavepoint(ctx context.Context, tx *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	name := fmt.Sprintf("golib_sp_%d", atomic.AddUint64(&savepointSeq, 1))
+	if err := tx.Exec("SAVEPOINT " + name).Error; err != nil {
+		return err
+	}
+	if TxFromContext(ctx) == nil {
+		ctx = context.WithValue(ctx, txKey{}, tx)
+	}
+	if _, ok := tx.Get(dbContextKey); !ok {
+		tx = DBWithContext(ctx, tx)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Exec("ROLLBACK TO SAVEPOINT " + name).Error; rbErr != nil {
+			return fmt.Errorf("%v, rollback to savepoint failed: %v", err, rbErr)
+		}
+		return err
+	}
+	return tx.Exec("RELEASE SAVEPOINT " + name).Error
+}
+
+// TxContext function for getting context of transaction started by WithTransaction,
+// WithTransaction called with this context runs inside a savepoint of tx
+func TxContext(tx *gorm.DB) context.Context {
+	if tx != nil {
+		if ctx, ok := tx.Get(dbContextKey); ok {
+			return ctx.(context.Context)
+		}
+	}
+	return context.Background()
+}
+
+// TxFromContext function for getting transaction carried by ctx
+func TxFromContext(ctx context.Context) *gorm.DB {
+	if ctx == nil {
+		return nil
+	}
+	tx, _ := ctx.Value(txKey{}).(*gorm.DB)
+	return tx
+}
+
+// IsRetryableTxError function for checking whether transaction failed with serialization failure or deadlock
+func IsRetryableTxError(err error) bool {
+	switch SQLState(err) {
+	case SQLStateSerializationFailure, SQLStateDeadlockDetected:
+		return true
+	}
+	return false
+}
+
+// SQLState function for getting SQLSTATE code of database error,
+// errors exposing SQLState() (pgx) or a Code field (lib/pq) are supported without importing the drivers
+func SQLState(err error) string {
+	if err == nil {
+		return ""
+	}
+	if e, ok := err.(interface{ SQLState() string }); ok {
+		return e.SQLState()
+	}
+
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if v.Kind() == reflect.Struct {
+		if code := v.FieldByName("Code"); code.IsValid() && code.Kind() == reflect.String {
+			return code.String()
+		}
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "could not serialize access"):
+		return SQLStateSerializationFailure
+	case strings.Contains(msg, "deadlock detected"):
+		return SQLStateDeadlockDetected
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package golib
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
+)
+
+type sqlStateError struct {
+	Code string
+}
+
+func (e *sqlStateError) Error() string { return "pq: " + e.Code }
+
+func TestWithTransactionDB(t *testing.T) {
+	db, mock := newMockGormDB(t)
+	opts := TxOptions{RetryBackoff: time.Millisecond, Isolation: sql.LevelSerializable}
+
+	t.Run("COMMIT WithTransactionDB", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err := WithTransactionDB(context.Background(), db, func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE orders SET status = 'paid'").Error
+		}, opts)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ROLLBACK ON ERROR WithTransactionDB", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		err := WithTransactionDB(context.Background(), db, func(tx *gorm.DB) error {
+			return errors.New("invalid order")
+		})
+		assert.EqualError(t, err, "invalid order")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ROLLBACK ON PANIC WithTransactionDB", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+
+		assert.Panics(t, func() {
+			WithTransactionDB(context.Background(), db, func(tx *gorm.DB) error {
+				panic("boom")
+			})
+		})
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("SAVEPOINT WithTransactionDB", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT golib_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT golib_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("SAVEPOINT golib_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("RELEASE SAVEPOINT golib_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err := WithTransactionDB(context.Background(), db, func(tx *gorm.DB) error {
+			ctx := TxContext(tx)
+			assert.NotNil(t, TxFromContext(ctx))
+
+			nestedErr := WithTransaction(ctx, func(tx *gorm.DB) error {
+				return errors.New("skip item")
+			})
+			assert.EqualError(t, nestedErr, "skip item")
+
+			return WithTransaction(ctx, func(tx *gorm.DB) error {
+				return nil
+			})
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NESTED TX WithTransactionDB", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT golib_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE orders").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("RELEASE SAVEPOINT golib_sp_").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		ctx := context.Background()
+		err := WithTransactionDB(ctx, db, func(tx *gorm.DB) error {
+			return WithTransactionDB(ctx, tx, func(tx *gorm.DB) error {
+				return tx.Exec("UPDATE orders SET status = 'paid'").Error
+			})
+		})
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RETRY SERIALIZATION FAILURE WithTransactionDB", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectCommit().WillReturnError(&sqlStateError{Code: SQLStateSerializationFailure})
+		mock.ExpectBegin()
+		mock.ExpectRollback().WillReturnError(errors.New("ignored"))
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		calls := 0
+		err := WithTransactionDB(context.Background(), db, func(tx *gorm.DB) error {
+			calls++
+			if calls == 2 {
+				return &sqlStateError{Code: SQLStateDeadlockDetected}
+			}
+			return nil
+		}, opts)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("RETRY LIMIT WithTransactionDB", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			mock.ExpectBegin()
+			mock.ExpectRollback()
+		}
+
+		retry := opts
+		retry.MaxRetries = 1
+		err := WithTransactionDB(context.Background(), db, func(tx *gorm.DB) error {
+			return &sqlStateError{Code: SQLStateSerializationFailure}
+		}, retry)
+		assert.True(t, IsRetryableTxError(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestSQLState(t *testing.T) {
+	t.Run("SUCCESS SQLState", func(t *testing.T) {
+		assert.Equal(t, "40001", SQLState(&sqlStateError{Code: "40001"}))
+		assert.Equal(t, SQLStateDeadlockDetected, SQLState(errors.New("ERROR: deadlock detected")))
+		assert.Equal(t, "", SQLState(errors.New("other")))
+		assert.Equal(t, "", SQLState(nil))
+	})
+}
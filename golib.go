@@ -1,18 +1,6 @@
+// Package golib common helpers shared by Bhinneka services: logging, database,
+// redis, validation and http response utilities.
+//
+// Importing the package does not change any global state, the logger outputs
+// are configured explicitly with SetupLogger.
 package golib
-
-import (
-	"log/syslog"
-
-	log "github.com/sirupsen/logrus"
-	logrusSyslog "github.com/sirupsen/logrus/hooks/syslog"
-)
-
-func init() {
-
-	// init logger configuration
-	log.SetFormatter(&log.JSONFormatter{})
-	if syslogOutput, err := logrusSyslog.NewSyslogHook("", "", syslog.LOG_INFO, LogTag); err == nil {
-		log.AddHook(syslogOutput)
-	}
-
-}
@@ -416,7 +416,7 @@ func IdentifyPanic(ctx string, rec interface{}) string {
 	return fmt.Sprintf("panic: %v", rec)
 }
 
-// MaskPassword for mask password string
+// MaskPassword for mask password string, see Redactor for masking other personal data
 func MaskPassword(s string) string {
 	splitText := strings.Split(s, "&")
 
@@ -531,7 +531,7 @@ func (c *collection) loadDomainList() {
 	}
 }
 
-// MaskJSONPassword mask password sent on JSON format
+// MaskJSONPassword mask password sent on JSON format, see Redactor for nested documents
 func MaskJSONPassword(body []byte) []byte {
 	dest := commonJSONAuth{}
 	if err := json.Unmarshal(body, &dest); err == nil {
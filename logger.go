@@ -2,9 +2,14 @@ package golib
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"encoding/json"
@@ -96,7 +101,7 @@ func LogContext(c string, s string, customeTags []map[string]interface{}) *log.E
 
 	result := MergeMaps(map1, maps)
 
-	return log.WithFields(result)
+	return currentLogger().WithFields(result)
 }
 
 // Log function for returning entry type
@@ -105,50 +110,43 @@ func LogContext(c string, s string, customeTags []map[string]interface{}) *log.E
 // context string context of log
 // scope string scope of log
 func Log(level Level, message string, context string, scope string, customeTags ...map[string]interface{}) {
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Println(r)
-			}
-		}()
-
-		entry := LogContext(context, scope, customeTags)
-		switch level {
-		case DebugLevel:
-			entry.Debug(message)
-		case InfoLevel:
-			entry.Info(message)
-		case WarnLevel:
-			entry.Warn(message)
-		case ErrorLevel:
-			entry.Error(message)
-		case FatalLevel:
-			entry.Fatal(message)
-		case PanicLevel:
-			entry.Panic(message)
-		}
-	}()
+	dispatch(LogContext(context, scope, customeTags), level, message)
+}
+
+// writeEntry function for writing entry with the given level
+func writeEntry(entry *log.Entry, level Level, message string) {
+	// loggers built by SetupLogger redact through RedactionHook, the standard logger is left without hooks
+	if entry.Logger == log.StandardLogger() {
+		message = DefaultRedactor().redactEntry(entry, message)
+	}
+
+	switch level {
+	case DebugLevel:
+		entry.Debug(message)
+	case InfoLevel:
+		entry.Info(message)
+	case WarnLevel:
+		entry.Warn(message)
+	case ErrorLevel:
+		entry.Error(message)
+	case FatalLevel:
+		entry.Fatal(message)
+	case PanicLevel:
+		entry.Panic(message)
+	}
 }
 
 // LogError logging error
 func LogError(err error, context string, messageData interface{}) {
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Println(r)
-			}
-		}()
-
-		entry := log.WithFields(log.Fields{
-			"topic":      TOPIC,
-			"context":    context,
-			"error":      err,
-			"server_env": Env,
-		})
-
-		jsonStr, _ := json.Marshal(messageData)
-		entry.Error(string(jsonStr))
-	}()
+	entry := currentLogger().WithFields(log.Fields{
+		"topic":      TOPIC,
+		"context":    context,
+		"error":      err,
+		"server_env": Env,
+	})
+
+	jsonStr, _ := json.Marshal(messageData)
+	dispatch(entry, ErrorLevel, string(jsonStr))
 }
 
 // ResultLogger result logger interface
@@ -156,21 +154,34 @@ type ResultLogger interface {
 	Store(c string, d []byte) string
 	Get(p string) string
 	RequestResponse(c string, dt string) string
+	Query(q ResultQuery, fn func(entry ResultEntry, payload io.Reader) error) error
 	LastError() error
 }
 
 // FileResultLogger file based storage
 type FileResultLogger struct {
+	mu        sync.Mutex
 	baseDir   string
 	lastError error
+	rotation  FileRotationConfig
 }
 
+// storeSequence sequence appended into stored file names, keeps names unique within the same second
+var storeSequence uint64
+
+var (
+	resultLoggerMu  sync.Mutex
+	resultLogger    ResultLogger
+	resultLoggerCfg ResultLoggerConfig
+)
+
 // newFileResultLogger private function for creating log file
 // base string directory
 func newFileResultLogger(base string) *FileResultLogger {
 	this := new(FileResultLogger)
+	this.rotation = getFileRotationConfig()
 	if err := this.createOrIgnore(base); err != nil {
-		this.lastError = err
+		this.setLastError(err)
 		return this
 	}
 	this.baseDir = base
@@ -179,9 +190,18 @@ func newFileResultLogger(base string) *FileResultLogger {
 
 // LastError function for getting last error
 func (flo *FileResultLogger) LastError() error {
+	flo.mu.Lock()
+	defer flo.mu.Unlock()
 	return flo.lastError
 }
 
+// setLastError function for setting last error
+func (flo *FileResultLogger) setLastError(err error) {
+	flo.mu.Lock()
+	flo.lastError = err
+	flo.mu.Unlock()
+}
+
 // createOrIgnore function for creating or ignoring error
 // p string
 func (flo *FileResultLogger) createOrIgnore(p string) error {
@@ -189,16 +209,16 @@ func (flo *FileResultLogger) createOrIgnore(p string) error {
 	if err != nil {
 		if os.IsNotExist(err) {
 			if err := os.MkdirAll(p, 0775); err != nil {
-				flo.lastError = err
+				flo.setLastError(err)
 				return err
 			}
 		} else {
-			flo.lastError = err
+			flo.setLastError(err)
 			return err
 		}
 	}
 
-	flo.lastError = nil
+	flo.setLastError(nil)
 	return nil
 }
 
@@ -206,42 +226,72 @@ func (flo *FileResultLogger) createOrIgnore(p string) error {
 // c string code name
 func (flo *FileResultLogger) GetFileName(c string) string {
 	t := time.Now()
-	u := strconv.Itoa(int(time.Now().Unix()))
-	f := fmt.Sprintf("%s_%s.%s", t.Format("150405"), u, c)
+	u := strconv.Itoa(int(t.Unix()))
+	f := fmt.Sprintf("%s_%s_%d.%s", t.Format("150405"), u, atomic.AddUint64(&storeSequence, 1), c)
 	return flo.baseDir + "/" + c + "/" + f
 }
 
 // Get  function to get log
-// p string file name
+// p string id returned by Store, path of stored file or file name inside STORAGE_DIR/archive
 func (flo *FileResultLogger) Get(p string) string {
-	base := os.Getenv("STORAGE_DIR")
-	f := base + "/archive/" + p
+	f := flo.resolve(p)
 	data, err := ioutil.ReadFile(f)
 	if err != nil {
-		flo.lastError = err
+		flo.setLastError(err)
 		return ""
 	}
 
-	flo.lastError = nil
+	flo.setLastError(nil)
 	return string(data)
 }
 
-// Store function to store log
+// resolve function for getting path of stored payload from its id
+// p string id, path or archived file name
+func (flo *FileResultLogger) resolve(p string) string {
+	if flo.baseDir != "" {
+		base := filepath.Clean(flo.baseDir)
+		for _, candidate := range []string{filepath.Join(base, p), filepath.Clean(p)} {
+			rel, err := filepath.Rel(base, candidate)
+			if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				continue
+			}
+			if _, err := os.Stat(candidate); err == nil {
+				return candidate
+			}
+		}
+	}
+
+	return os.Getenv("STORAGE_DIR") + "/archive/" + p
+}
+
+// Store function to store log, the returned id "<code>/<file name>" is accepted by Get
 // c string code name
 // d []byte json data which is about to stored
 func (flo *FileResultLogger) Store(c string, d []byte) string {
 	fileName := flo.GetFileName(c)
+	id := c + "/" + filepath.Base(fileName)
 	if err := flo.createOrIgnore(flo.baseDir + "/" + c); err != nil {
-		flo.lastError = err
-		return fileName
+		flo.setLastError(err)
+		return id
 	}
 
-	flo.lastError = nil
+	flo.setLastError(nil)
 	if err := ioutil.WriteFile(fileName, d, 0775); err != nil {
-		flo.lastError = err
+		flo.setLastError(err)
+		return id
 	}
 
-	return fileName
+	// stored payloads are read back by Get, they are never compressed
+	retention := flo.rotation
+	retention.Compress = false
+	scheduleCleanup(retentionJob{
+		code:  c,
+		dir:   flo.baseDir + "/" + c,
+		match: func(name string) bool { return true },
+		cfg:   retention,
+	})
+
+	return id
 }
 
 // RequestResponse function for storing request and response into file
@@ -255,27 +305,64 @@ func (flo *FileResultLogger) RequestResponse(c string, dt string) string {
 	filename := fmt.Sprintf("%s%s.%s", dir, t.Format("20060102"), c)
 	val := fmt.Sprintf("%s : %s", t.Format("15:04:05"), dt)
 
-	if err := flo.createOrIgnore(dir); err == nil {
-		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0775)
-		if err == nil {
-			if _, err = f.WriteString(val); err != nil {
-				panic(err)
-			}
-		}
+	if err := flo.createOrIgnore(dir); err != nil {
+		return ""
+	}
 
-		defer f.Close()
+	if err := appendRotating(filename, []byte(val), flo.rotation); err != nil {
+		flo.setLastError(err)
+		return ""
 	}
 
+	// files of the code are "YYYYMMDD.<code>" and rotated "YYYYMMDD.<code>.<unix nano>", compressed files add ".gz",
+	// preceded by another ".<unix nano>" when the archive name was already taken
+	suffix := "." + c
+	scheduleCleanup(retentionJob{
+		code:   c,
+		dir:    dir,
+		active: filename,
+		match: func(name string) bool {
+			if len(name) < 8 || strings.Trim(name[:8], "0123456789") != "" {
+				return false
+			}
+			rest := strings.TrimSuffix(name[8:], ".gz")
+			if rest == suffix {
+				return true
+			}
+			if !strings.HasPrefix(rest, suffix+".") {
+				return false
+			}
+			for _, part := range strings.Split(rest[len(suffix)+1:], ".") {
+				if part == "" || strings.Trim(part, "0123456789") != "" {
+					return false
+				}
+			}
+			return true
+		},
+		cfg: flo.rotation,
+	})
+
 	return ""
 }
 
-// GetResultLogger function for getting log result
+// GetResultLogger function for getting log result,
+// the backend is chosen from environment, see ResultLoggerConfigFromEnv, and is created once per configuration
 func GetResultLogger() ResultLogger {
-	base := os.Getenv("LOG_DIR")
-	if base == "" {
-		base = os.Getenv("STORAGE_DIR") + "/logs/"
+	cfg := ResultLoggerConfigFromEnv()
+
+	resultLoggerMu.Lock()
+	defer resultLoggerMu.Unlock()
+	if resultLogger != nil && resultLoggerCfg == cfg {
+		return resultLogger
+	}
+
+	rl := NewResultLogger(cfg)
+	// a file logger whose directory could not be created is not kept, the next call creates it again
+	if f, ok := rl.(*FileResultLogger); ok && f.baseDir == "" {
+		return rl
 	}
-	return newFileResultLogger(base)
+	resultLogger, resultLoggerCfg = rl, cfg
+	return rl
 }
 
 // StoreRequestResponse function for storing request and response into file
@@ -286,12 +373,14 @@ func StoreRequestResponse(code string, req []byte, res []byte) string {
 	// set data to save/append into log
 	data := "REQUEST: " + string(req[:]) + " RESPONSE: " + string(res[:]) + "\n"
 
-	var fileLogger ResultLogger
-	fileLogger = GetResultLogger()
-
-	if fileLogger.LastError() != nil {
+	rl := GetResultLogger()
+	if f, ok := rl.(*FileResultLogger); ok && f.baseDir == "" {
 		return ""
 	}
 
-	return fileLogger.RequestResponse(code, data)
+	result := rl.RequestResponse(code, data)
+	if err := rl.LastError(); err != nil {
+		LogError(err, "result_logger", code)
+	}
+	return result
 }
@@ -0,0 +1,150 @@
+package golib
+
+import (
+	"context"
+	"encoding/json"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	log "github.com/sirupsen/logrus"
+	jaeger "github.com/uber/jaeger-client-go"
+)
+
+// logContextKey type of key for values stored by golib inside context.Context
+type logContextKey int
+
+const (
+	requestIDKey logContextKey = iota
+	logFieldsKey
+)
+
+// WithRequestID function for storing request id into context
+// ctx context.Context parent context
+// id string request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext function for getting request id from context
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithLogFields function for storing additional log fields into context,
+// the fields are merged with the fields already stored in the parent context
+// ctx context.Context parent context
+// fields map[string]interface{} fields attached to every log written with this context
+func WithLogFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	merged := make(map[string]interface{})
+	for k, v := range LogFieldsFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, logFieldsKey, merged)
+}
+
+// LogFieldsFromContext function for getting log fields stored in context
+func LogFieldsFromContext(ctx context.Context) map[string]interface{} {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logFieldsKey).(map[string]interface{})
+	return fields
+}
+
+// TraceIDFromContext function for getting trace id of the active span in context
+func TraceIDFromContext(ctx context.Context) string {
+	traceID, _ := spanIDs(ctx)
+	return traceID
+}
+
+// SpanIDFromContext function for getting span id of the active span in context
+func SpanIDFromContext(ctx context.Context) string {
+	_, spanID := spanIDs(ctx)
+	return spanID
+}
+
+// spanIDs function for getting trace id and span id of the active jaeger span in context
+func spanIDs(ctx context.Context) (traceID, spanID string) {
+	if ctx == nil {
+		return "", ""
+	}
+
+	span := opentracing.SpanFromContext(ctx)
+	if span == nil {
+		return "", ""
+	}
+
+	// ids of other tracers such as the opentracing noop tracer are unknown
+	sc, ok := span.Context().(jaeger.SpanContext)
+	if !ok || !sc.IsValid() {
+		return "", ""
+	}
+	return sc.TraceID().String(), sc.SpanID().String()
+}
+
+// contextFields function for collecting trace id, span id, request id and custom fields from context
+func contextFields(ctx context.Context) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for k, v := range LogFieldsFromContext(ctx) {
+		fields[k] = v
+	}
+
+	traceID, spanID := spanIDs(ctx)
+	if traceID != "" {
+		fields["trace_id"] = traceID
+	}
+	if spanID != "" {
+		fields["span_id"] = spanID
+	}
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		fields["request_id"] = requestID
+	}
+
+	return fields
+}
+
+// LogContextCtx function for creating log entry with the values carried by ctx
+// ctx context.Context
+// c string context
+// s string scope
+func LogContextCtx(ctx context.Context, c string, s string, customeTags []map[string]interface{}) *log.Entry {
+	tags := append([]map[string]interface{}{contextFields(ctx)}, customeTags...)
+	entry := LogContext(c, s, tags)
+	if ctx != nil {
+		entry = entry.WithContext(ctx)
+	}
+	return entry
+}
+
+// LogCtx function for logging with trace id, span id, request id and fields stored in ctx
+// ctx context.Context
+// level log.Level
+// message string message of log
+// logContext string context of log
+// scope string scope of log
+func LogCtx(ctx context.Context, level Level, message string, logContext string, scope string, customeTags ...map[string]interface{}) {
+	dispatch(LogContextCtx(ctx, logContext, scope, customeTags), level, message)
+}
+
+// LogErrorCtx logging error with trace id, span id, request id and fields stored in ctx
+func LogErrorCtx(ctx context.Context, err error, logContext string, messageData interface{}) {
+	fields := log.Fields{
+		"topic":      TOPIC,
+		"context":    logContext,
+		"error":      err,
+		"server_env": Env,
+	}
+	entry := currentLogger().WithFields(MergeMaps(contextFields(ctx), fields))
+	if ctx != nil {
+		entry = entry.WithContext(ctx)
+	}
+
+	jsonStr, _ := json.Marshal(messageData)
+	dispatch(entry, ErrorLevel, string(jsonStr))
+}
@@ -0,0 +1,92 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/stretchr/testify/assert"
+	jaeger "github.com/uber/jaeger-client-go"
+)
+
+func newTestSpanContext() (context.Context, jaeger.SpanContext, func()) {
+	tracer, closer := jaeger.NewTracer("test", jaeger.NewConstSampler(true), jaeger.NewNullReporter())
+	span := tracer.StartSpan("test")
+	ctx := opentracing.ContextWithSpan(context.Background(), span)
+	return ctx, span.Context().(jaeger.SpanContext), func() {
+		span.Finish()
+		closer.Close()
+	}
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	t.Run("SUCCESS RequestIDFromContext", func(t *testing.T) {
+		ctx := WithRequestID(context.Background(), "req-1")
+		assert.Equal(t, "req-1", RequestIDFromContext(ctx))
+	})
+
+	t.Run("EMPTY RequestIDFromContext", func(t *testing.T) {
+		assert.Equal(t, "", RequestIDFromContext(context.Background()))
+	})
+}
+
+func TestWithLogFields(t *testing.T) {
+	t.Run("MERGE WithLogFields", func(t *testing.T) {
+		ctx := WithLogFields(context.Background(), map[string]interface{}{"a": 1, "b": 1})
+		ctx = WithLogFields(ctx, map[string]interface{}{"b": 2})
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, LogFieldsFromContext(ctx))
+	})
+}
+
+func TestTraceIDFromContext(t *testing.T) {
+	t.Run("SUCCESS TraceIDFromContext", func(t *testing.T) {
+		ctx, sc, finish := newTestSpanContext()
+		defer finish()
+
+		assert.Equal(t, sc.TraceID().String(), TraceIDFromContext(ctx))
+		assert.Equal(t, sc.SpanID().String(), SpanIDFromContext(ctx))
+	})
+
+	t.Run("NOOP SPAN TraceIDFromContext", func(t *testing.T) {
+		ctx := opentracing.ContextWithSpan(context.Background(), opentracing.NoopTracer{}.StartSpan("test"))
+		assert.Equal(t, "", TraceIDFromContext(ctx))
+		assert.Equal(t, "", SpanIDFromContext(ctx))
+		assert.NotContains(t, LogContextCtx(ctx, "test", "scope", nil).Data, "trace_id")
+	})
+
+	t.Run("NO SPAN TraceIDFromContext", func(t *testing.T) {
+		assert.Equal(t, "", TraceIDFromContext(context.Background()))
+		assert.Equal(t, "", SpanIDFromContext(context.Background()))
+	})
+}
+
+func TestLogContextCtx(t *testing.T) {
+	t.Run("SUCCESS LogContextCtx", func(t *testing.T) {
+		ctx, sc, finish := newTestSpanContext()
+		defer finish()
+		ctx = WithRequestID(ctx, "req-1")
+		ctx = WithLogFields(ctx, map[string]interface{}{"order_id": "SO-1"})
+
+		entry := LogContextCtx(ctx, "test", "scope", []map[string]interface{}{{"custom": "tag"}})
+		assert.Equal(t, sc.TraceID().String(), entry.Data["trace_id"])
+		assert.Equal(t, sc.SpanID().String(), entry.Data["span_id"])
+		assert.Equal(t, "req-1", entry.Data["request_id"])
+		assert.Equal(t, "SO-1", entry.Data["order_id"])
+		assert.Equal(t, "tag", entry.Data["custom"])
+		assert.Equal(t, "test", entry.Data["context"])
+		assert.Equal(t, ctx, entry.Context)
+	})
+}
+
+func TestLogCtx(t *testing.T) {
+	t.Run("InfoLevel LogCtx", func(t *testing.T) {
+		ctx := WithRequestID(context.Background(), "req-1")
+		LogCtx(ctx, InfoLevel, "test", "test", "test", map[string]interface{}{"test": "test"})
+	})
+
+	t.Run("LogErrorCtx", func(t *testing.T) {
+		ctx := WithRequestID(context.Background(), "req-1")
+		LogErrorCtx(ctx, errors.New("test"), "test", "test")
+	})
+}
@@ -0,0 +1,222 @@
+package golib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogSchema data model written by SchemaFormatter
+type LogSchema string
+
+const (
+	// LogSchemaECS Elastic Common Schema
+	LogSchemaECS LogSchema = "ecs"
+	// LogSchemaOTel OpenTelemetry log data model
+	LogSchemaOTel LogSchema = "otel"
+
+	// LogSchemaVersion version of golib field mapping, bumped whenever the mapping changes
+	LogSchemaVersion = 1
+	// LogSchemaField field carrying "<schema>/<version>" so pipelines can tell formats apart
+	LogSchemaField = "golib.schema"
+	// ECSVersion version of Elastic Common Schema written by SchemaFormatter
+	ECSVersion = "1.12.0"
+)
+
+// otelSeverity severity number of OpenTelemetry log data model per logrus level
+var otelSeverity = map[log.Level]int{
+	log.TraceLevel: 1,
+	log.DebugLevel: 5,
+	log.InfoLevel:  9,
+	log.WarnLevel:  13,
+	log.ErrorLevel: 17,
+	log.FatalLevel: 21,
+	log.PanicLevel: 24,
+}
+
+// SchemaFormatter logrus formatter writing Elastic Common Schema or OpenTelemetry log data model json,
+// golib fields (topic, context, scope, server_env, trace_id, span_id, request_id, error) are mapped onto the schema,
+// other fields are written as labels (ECS) or attributes (OTel)
+type SchemaFormatter struct {
+	// Schema data model, default LogSchemaECS
+	Schema LogSchema
+	// ServiceName name of the service, default LogTag
+	ServiceName string
+	// ServiceVersion version of the service
+	ServiceVersion string
+}
+
+// NewECSFormatter function for creating formatter writing Elastic Common Schema
+// serviceName string name of the service, empty uses LogTag
+func NewECSFormatter(serviceName string) *SchemaFormatter {
+	return &SchemaFormatter{Schema: LogSchemaECS, ServiceName: serviceName}
+}
+
+// NewOTelFormatter function for creating formatter writing OpenTelemetry log data model
+// serviceName string name of the service, empty uses LogTag
+func NewOTelFormatter(serviceName string) *SchemaFormatter {
+	return &SchemaFormatter{Schema: LogSchemaOTel, ServiceName: serviceName}
+}
+
+// schemaEntry golib fields of entry separated from custom fields
+type schemaEntry struct {
+	topic, context, scope, env    string
+	traceID, spanID, requestID    string
+	errMessage, errType, errStack string
+	custom                        map[string]interface{}
+}
+
+// Format function for formatting entry
+func (f *SchemaFormatter) Format(entry *log.Entry) ([]byte, error) {
+	e := splitSchemaEntry(entry)
+
+	var doc map[string]interface{}
+	if f.Schema == LogSchemaOTel {
+		doc = f.otel(entry, e)
+	} else {
+		doc = f.ecs(entry, e)
+	}
+
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal fields to JSON, %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// serviceName function for getting configured service name or LogTag
+func (f *SchemaFormatter) serviceName() string {
+	if f.ServiceName != "" {
+		return f.ServiceName
+	}
+	return LogTag
+}
+
+// ecs function for building Elastic Common Schema document
+func (f *SchemaFormatter) ecs(entry *log.Entry, e schemaEntry) map[string]interface{} {
+	doc := map[string]interface{}{
+		"@timestamp":   entry.Time.UTC().Format(time.RFC3339Nano),
+		"log.level":    entry.Level.String(),
+		"message":      entry.Message,
+		"ecs.version":  ECSVersion,
+		LogSchemaField: fmt.Sprintf("%s/%d", LogSchemaECS, LogSchemaVersion),
+	}
+
+	putString(doc, "service.name", f.serviceName())
+	putString(doc, "service.version", f.ServiceVersion)
+	putString(doc, "service.environment", e.env)
+	putString(doc, "event.dataset", e.topic)
+	putString(doc, "log.logger", e.context)
+	putString(doc, "event.action", e.scope)
+	putString(doc, "trace.id", e.traceID)
+	putString(doc, "span.id", e.spanID)
+	putString(doc, "http.request.id", e.requestID)
+	putString(doc, "error.message", e.errMessage)
+	putString(doc, "error.type", e.errType)
+	putString(doc, "error.stack_trace", e.errStack)
+	if len(e.custom) > 0 {
+		doc["labels"] = e.custom
+	}
+	return doc
+}
+
+// otel function for building OpenTelemetry log data model document
+func (f *SchemaFormatter) otel(entry *log.Entry, e schemaEntry) map[string]interface{} {
+	resource := map[string]interface{}{}
+	putString(resource, "service.name", f.serviceName())
+	putString(resource, "service.version", f.ServiceVersion)
+	putString(resource, "deployment.environment", e.env)
+
+	attributes := map[string]interface{}{}
+	for k, v := range e.custom {
+		attributes[k] = v
+	}
+	attributes[LogSchemaField] = fmt.Sprintf("%s/%d", LogSchemaOTel, LogSchemaVersion)
+	putString(attributes, "golib.topic", e.topic)
+	putString(attributes, "golib.context", e.context)
+	putString(attributes, "golib.scope", e.scope)
+	putString(attributes, "http.request.id", e.requestID)
+	putString(attributes, "exception.message", e.errMessage)
+	putString(attributes, "exception.type", e.errType)
+	putString(attributes, "exception.stacktrace", e.errStack)
+
+	doc := map[string]interface{}{
+		"Timestamp":      strconv.FormatInt(entry.Time.UnixNano(), 10),
+		"SeverityText":   entry.Level.String(),
+		"SeverityNumber": otelSeverity[entry.Level],
+		"Body":           entry.Message,
+		"Resource":       resource,
+		"Attributes":     attributes,
+	}
+	putString(doc, "TraceId", e.traceID)
+	putString(doc, "SpanId", e.spanID)
+	return doc
+}
+
+// splitSchemaEntry function for separating golib fields of entry from custom fields
+func splitSchemaEntry(entry *log.Entry) schemaEntry {
+	e := schemaEntry{custom: make(map[string]interface{}, len(entry.Data))}
+	for k, v := range entry.Data {
+		switch k {
+		case "topic":
+			e.topic = fmt.Sprint(v)
+		case "context":
+			e.context = fmt.Sprint(v)
+		case "scope":
+			e.scope = fmt.Sprint(v)
+		case "server_env":
+			e.env = fmt.Sprint(v)
+		case "trace_id":
+			e.traceID = fmt.Sprint(v)
+		case "span_id":
+			e.spanID = fmt.Sprint(v)
+		case "request_id":
+			e.requestID = fmt.Sprint(v)
+		case log.ErrorKey:
+			if v == nil {
+				continue
+			}
+			if err, ok := v.(error); ok {
+				e.errMessage = err.Error()
+				e.errType = fmt.Sprintf("%T", err)
+				// errors carrying a stack trace such as github.com/pkg/errors print it with %+v
+				if stack := fmt.Sprintf("%+v", err); stack != e.errMessage {
+					e.errStack = stack
+				}
+				continue
+			}
+			e.errMessage = fmt.Sprint(v)
+		default:
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			e.custom[k] = v
+		}
+	}
+
+	if entry.Context != nil {
+		if e.traceID == "" {
+			e.traceID = TraceIDFromContext(entry.Context)
+		}
+		if e.spanID == "" {
+			e.spanID = SpanIDFromContext(entry.Context)
+		}
+		if e.requestID == "" {
+			e.requestID = RequestIDFromContext(entry.Context)
+		}
+	}
+	return e
+}
+
+// putString function for setting non empty value of key
+func putString(m map[string]interface{}, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
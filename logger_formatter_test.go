@@ -0,0 +1,89 @@
+package golib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+type stackError struct{}
+
+func (stackError) Error() string { return "broken" }
+
+func (e stackError) Format(s fmt.State, verb rune) {
+	if s.Flag('+') {
+		fmt.Fprint(s, "broken\nmain.go:10")
+		return
+	}
+	fmt.Fprint(s, e.Error())
+}
+
+func formatSchemaEntry(t *testing.T, f *SchemaFormatter, entry *log.Entry) map[string]interface{} {
+	b, err := f.Format(entry)
+	assert.NoError(t, err)
+
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &doc))
+	return doc
+}
+
+func TestSchemaFormatter(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ctx := WithRequestID(context.Background(), "req-1")
+	newEntry := func(err error) *log.Entry {
+		entry := log.NewEntry(log.New()).WithContext(ctx).WithTime(ts).WithFields(log.Fields{
+			"topic":      "orders",
+			"context":    "order",
+			"scope":      "create",
+			"server_env": "production",
+			"trace_id":   "abc",
+			"error":      err,
+			"orderId":    10,
+		})
+		entry.Level = log.ErrorLevel
+		entry.Message = "failed"
+		return entry
+	}
+
+	t.Run("ECS SchemaFormatter", func(t *testing.T) {
+		doc := formatSchemaEntry(t, NewECSFormatter("order-service"), newEntry(stackError{}))
+
+		assert.Equal(t, "2020-01-02T03:04:05Z", doc["@timestamp"])
+		assert.Equal(t, "error", doc["log.level"])
+		assert.Equal(t, "failed", doc["message"])
+		assert.Equal(t, "ecs/1", doc[LogSchemaField])
+		assert.Equal(t, "order-service", doc["service.name"])
+		assert.Equal(t, "production", doc["service.environment"])
+		assert.Equal(t, "orders", doc["event.dataset"])
+		assert.Equal(t, "order", doc["log.logger"])
+		assert.Equal(t, "create", doc["event.action"])
+		assert.Equal(t, "abc", doc["trace.id"])
+		assert.Equal(t, "req-1", doc["http.request.id"])
+		assert.Equal(t, "broken", doc["error.message"])
+		assert.Equal(t, "broken\nmain.go:10", doc["error.stack_trace"])
+		assert.Equal(t, float64(10), doc["labels"].(map[string]interface{})["orderId"])
+		assert.Nil(t, doc["topic"])
+	})
+
+	t.Run("OTEL SchemaFormatter", func(t *testing.T) {
+		doc := formatSchemaEntry(t, NewOTelFormatter("order-service"), newEntry(errors.New("plain")))
+
+		assert.Equal(t, fmt.Sprint(ts.UnixNano()), doc["Timestamp"])
+		assert.Equal(t, float64(17), doc["SeverityNumber"])
+		assert.Equal(t, "failed", doc["Body"])
+		assert.Equal(t, "abc", doc["TraceId"])
+		assert.Equal(t, "order-service", doc["Resource"].(map[string]interface{})["service.name"])
+
+		attributes := doc["Attributes"].(map[string]interface{})
+		assert.Equal(t, "otel/1", attributes[LogSchemaField])
+		assert.Equal(t, "plain", attributes["exception.message"])
+		assert.Nil(t, attributes["exception.stacktrace"])
+		assert.Equal(t, float64(10), attributes["orderId"])
+	})
+}
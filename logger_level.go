@@ -0,0 +1,243 @@
+package golib
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultLogLevelOverrideTTL lifetime of scope override created without ttl
+const DefaultLogLevelOverrideTTL = time.Hour
+
+// LogLevelOverride minimum level of a single context or scope
+type LogLevelOverride struct {
+	Scope     string    `json:"scope"`
+	Level     string    `json:"level"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// levelOverride active override of a scope
+type levelOverride struct {
+	level   Level
+	expires time.Time
+	timer   *time.Timer
+}
+
+// logLevelRequest body accepted by LogLevelHandler
+type logLevelRequest struct {
+	Scope string `json:"scope"`
+	Level string `json:"level"`
+	TTL   string `json:"ttl"`
+}
+
+var (
+	levelMu     sync.RWMutex
+	globalLevel = InfoLevel
+	// globalLevelSet global level was set by SetLogLevel
+	globalLevelSet bool
+	// globalLevelKnown global level was set by SetLogLevel, SetupLogger or a scope override,
+	// before that it follows level of the logrus logger
+	globalLevelKnown bool
+	scopeLevels      = map[string]*levelOverride{}
+)
+
+// ParseLevel function for parsing level name such as "debug" or "warning"
+func ParseLevel(s string) (Level, error) {
+	l, err := log.ParseLevel(s)
+	return Level(l), err
+}
+
+// SetLogLevel function for changing global minimum level of Log, LogCtx and LogError at runtime
+func SetLogLevel(level Level) {
+	levelMu.Lock()
+	globalLevel = level
+	globalLevelSet = true
+	globalLevelKnown = true
+	levelMu.Unlock()
+
+	syncLoggerLevel()
+}
+
+// GetLogLevel function for getting global minimum level
+func GetLogLevel() Level {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+	return currentGlobalLevel()
+}
+
+// currentGlobalLevel function for getting global level, until it is known the level of the logrus logger is used
+// so logrus.SetLevel called by the application keeps working, caller holds levelMu
+func currentGlobalLevel() Level {
+	if globalLevelKnown {
+		return globalLevel
+	}
+	return Level(currentLogger().GetLevel())
+}
+
+// setDefaultLogLevel function for changing global level unless it was set explicitly by SetLogLevel
+func setDefaultLogLevel(level Level) {
+	levelMu.Lock()
+	if !globalLevelSet {
+		globalLevel = level
+		globalLevelKnown = true
+	}
+	levelMu.Unlock()
+}
+
+// SetScopeLogLevel function for overriding minimum level of entries whose scope or context equals scope,
+// the override is removed automatically after ttl
+// scope string scope or context value passed to Log
+// level Level minimum level of the scope
+// ttl time.Duration lifetime of the override, zero uses DefaultLogLevelOverrideTTL
+func SetScopeLogLevel(scope string, level Level, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultLogLevelOverrideTTL
+	}
+
+	levelMu.Lock()
+	if previous, ok := scopeLevels[scope]; ok {
+		previous.timer.Stop()
+	}
+	override := &levelOverride{level: level, expires: time.Now().Add(ttl)}
+	override.timer = time.AfterFunc(ttl, func() {
+		levelMu.Lock()
+		if scopeLevels[scope] == override {
+			delete(scopeLevels, scope)
+		}
+		levelMu.Unlock()
+		syncLoggerLevel()
+	})
+	scopeLevels[scope] = override
+	levelMu.Unlock()
+
+	syncLoggerLevel()
+}
+
+// RemoveScopeLogLevel function for removing override of the scope
+func RemoveScopeLogLevel(scope string) {
+	levelMu.Lock()
+	if override, ok := scopeLevels[scope]; ok {
+		override.timer.Stop()
+		delete(scopeLevels, scope)
+	}
+	levelMu.Unlock()
+
+	syncLoggerLevel()
+}
+
+// GetScopeLogLevels function for listing active overrides ordered by scope
+func GetScopeLogLevels() []LogLevelOverride {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+
+	now := time.Now()
+	overrides := make([]LogLevelOverride, 0, len(scopeLevels))
+	for scope, o := range scopeLevels {
+		if now.After(o.expires) {
+			continue
+		}
+		overrides = append(overrides, LogLevelOverride{Scope: scope, Level: o.level.String(), ExpiresAt: o.expires})
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].Scope < overrides[j].Scope
+	})
+	return overrides
+}
+
+// logLevelEnabled function for checking entry level against the override of scope or context, or the global level
+func logLevelEnabled(level Level, context, scope string) bool {
+	levelMu.RLock()
+	defer levelMu.RUnlock()
+
+	now := time.Now()
+	for _, key := range []string{scope, context} {
+		if key == "" {
+			continue
+		}
+		if o, ok := scopeLevels[key]; ok && !now.After(o.expires) {
+			return level <= o.level
+		}
+	}
+	return level <= currentGlobalLevel()
+}
+
+// syncLoggerLevel function for setting level of logrus logger to the most verbose active level,
+// so entries allowed by an override are not discarded by logrus,
+// the level of the logrus logger is kept as global level before golib changes it the first time
+func syncLoggerLevel() {
+	levelMu.Lock()
+	if !globalLevelKnown {
+		if len(scopeLevels) == 0 {
+			levelMu.Unlock()
+			return
+		}
+		globalLevel = Level(currentLogger().GetLevel())
+		globalLevelKnown = true
+	}
+	max := globalLevel
+	for _, o := range scopeLevels {
+		if o.level > max {
+			max = o.level
+		}
+	}
+	levelMu.Unlock()
+
+	if max > TraceLevel {
+		max = TraceLevel
+	}
+	currentLogger().SetLevel(log.Level(max))
+}
+
+// LogLevelHandler function for getting http handler managing log levels at runtime:
+// GET lists global level and overrides,
+// PUT or POST with {"level":"debug"} changes global level,
+// PUT or POST with {"scope":"payment","level":"debug","ttl":"10m"} overrides level of a scope,
+// DELETE with ?scope=payment removes the override
+func LogLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var body logLevelRequest
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				NewHTTPResponseV2(http.StatusBadRequest, fmt.Sprintf(PayloadInvalid, "log level")).JSON(w)
+				return
+			}
+
+			level, err := ParseLevel(body.Level)
+			if err != nil {
+				NewHTTPResponseV2(http.StatusBadRequest, err.Error()).JSON(w)
+				return
+			}
+
+			if body.Scope == "" {
+				SetLogLevel(level)
+				break
+			}
+
+			var ttl time.Duration
+			if body.TTL != "" {
+				if ttl, err = time.ParseDuration(body.TTL); err != nil {
+					NewHTTPResponseV2(http.StatusBadRequest, err.Error()).JSON(w)
+					return
+				}
+			}
+			SetScopeLogLevel(body.Scope, level, ttl)
+		case http.MethodDelete:
+			RemoveScopeLogLevel(req.URL.Query().Get("scope"))
+		default:
+			NewHTTPResponseV2(http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed)).JSON(w)
+			return
+		}
+
+		NewHTTPResponseV2(http.StatusOK, "log level", map[string]interface{}{
+			"level":     GetLogLevel().String(),
+			"overrides": GetScopeLogLevels(),
+		}).JSON(w)
+	})
+}
@@ -0,0 +1,163 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func resetLogLevels() {
+	for _, o := range GetScopeLogLevels() {
+		RemoveScopeLogLevel(o.Scope)
+	}
+	levelMu.Lock()
+	globalLevel = InfoLevel
+	globalLevelSet = false
+	globalLevelKnown = true
+	levelMu.Unlock()
+	syncLoggerLevel()
+}
+
+func TestParseLevel(t *testing.T) {
+	t.Run("SUCCESS ParseLevel", func(t *testing.T) {
+		l, err := ParseLevel("debug")
+		assert.NoError(t, err)
+		assert.Equal(t, DebugLevel, l)
+	})
+
+	t.Run("ERROR ParseLevel", func(t *testing.T) {
+		_, err := ParseLevel("verbose")
+		assert.Error(t, err)
+	})
+}
+
+func TestSetLogLevel(t *testing.T) {
+	defer closeLoggerOutputs()
+	defer resetLogLevels()
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf, Level: TraceLevel}}}))
+
+	t.Run("GLOBAL SetLogLevel", func(t *testing.T) {
+		SetLogLevel(WarnLevel)
+		Log(InfoLevel, "global info", "order", "create")
+		Log(WarnLevel, "global warn", "order", "create")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.Equal(t, WarnLevel, GetLogLevel())
+		assert.NotContains(t, buf.String(), "global info")
+		assert.Contains(t, buf.String(), "global warn")
+	})
+
+	t.Run("SCOPE SetScopeLogLevel", func(t *testing.T) {
+		SetScopeLogLevel("payment", DebugLevel, time.Minute)
+		Log(DebugLevel, "payment debug", "payment", "charge")
+		Log(DebugLevel, "order debug", "order", "create")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.Contains(t, buf.String(), "payment debug")
+		assert.NotContains(t, buf.String(), "order debug")
+		assert.Len(t, GetScopeLogLevels(), 1)
+	})
+
+	t.Run("EXPIRED SetScopeLogLevel", func(t *testing.T) {
+		SetScopeLogLevel("refund", DebugLevel, 10*time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		Log(DebugLevel, "refund debug", "refund", "create")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.NotContains(t, buf.String(), "refund debug")
+		for _, o := range GetScopeLogLevels() {
+			assert.NotEqual(t, "refund", o.Scope)
+		}
+	})
+
+	t.Run("FATAL IGNORES LEVEL", func(t *testing.T) {
+		SetLogLevel(PanicLevel)
+		assert.Panics(t, func() {
+			Log(PanicLevel, "panic", "order", "create")
+		})
+	})
+}
+
+func TestLogLevelFromLogrus(t *testing.T) {
+	defer resetLogLevels()
+	l := currentLogger()
+	defer l.SetLevel(l.GetLevel())
+
+	levelMu.Lock()
+	globalLevelSet = false
+	globalLevelKnown = false
+	levelMu.Unlock()
+
+	t.Run("LOGRUS LEVEL GetLogLevel", func(t *testing.T) {
+		l.SetLevel(log.DebugLevel)
+		assert.Equal(t, DebugLevel, GetLogLevel())
+		assert.True(t, logLevelEnabled(DebugLevel, "order", "create"))
+		assert.False(t, logLevelEnabled(TraceLevel, "order", "create"))
+	})
+
+	t.Run("KEPT AFTER OVERRIDE GetLogLevel", func(t *testing.T) {
+		SetScopeLogLevel("payment", TraceLevel, time.Minute)
+		assert.Equal(t, log.TraceLevel, l.GetLevel())
+		assert.False(t, logLevelEnabled(TraceLevel, "order", "create"))
+
+		RemoveScopeLogLevel("payment")
+		assert.Equal(t, DebugLevel, GetLogLevel())
+		assert.Equal(t, log.DebugLevel, l.GetLevel())
+	})
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	defer resetLogLevels()
+	h := LogLevelHandler()
+
+	t.Run("PUT GLOBAL LogLevelHandler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"error"}`)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, ErrorLevel, GetLogLevel())
+	})
+
+	t.Run("PUT SCOPE LogLevelHandler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"scope":"payment","level":"debug","ttl":"5m"}`)))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"scope":"payment"`)
+	})
+
+	t.Run("GET LogLevelHandler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"level":"error"`)
+	})
+
+	t.Run("DELETE LogLevelHandler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/?scope=payment", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, GetScopeLogLevels())
+	})
+
+	t.Run("BAD REQUEST LogLevelHandler", func(t *testing.T) {
+		for _, body := range []string{`{`, `{"level":"verbose"}`, `{"scope":"a","level":"debug","ttl":"soon"}`} {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		}
+	})
+
+	t.Run("METHOD NOT ALLOWED LogLevelHandler", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPatch, "/", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	})
+}
@@ -0,0 +1,428 @@
+package golib
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/syslog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// LogOutputType destination kind of log output
+type LogOutputType string
+
+const (
+	// LogOutputStdout writes entries to standard output
+	LogOutputStdout LogOutputType = "stdout"
+	// LogOutputWriter writes entries to LogOutputConfig.Writer
+	LogOutputWriter LogOutputType = "writer"
+	// LogOutputFile appends entries to LogOutputConfig.Path
+	LogOutputFile LogOutputType = "file"
+	// LogOutputSyslog sends entries to the local syslog daemon
+	LogOutputSyslog LogOutputType = "syslog"
+	// LogOutputRemoteSyslog sends RFC 5424 framed entries over udp, tcp or tls
+	LogOutputRemoteSyslog LogOutputType = "remote_syslog"
+)
+
+// rfc5424Time timestamp format of RFC 5424 header
+const rfc5424Time = "2006-01-02T15:04:05.000000Z07:00"
+
+// LogOutputConfig configuration of single log output
+type LogOutputConfig struct {
+	Type LogOutputType
+	// Level minimum level written to this output, zero value (PanicLevel) defaults to InfoLevel
+	Level Level
+	// Formatter of entries, default JSON formatter
+	Formatter log.Formatter
+	// Writer destination of LogOutputWriter output
+	Writer io.Writer
+	// Path of log file, used by LogOutputFile output
+	Path string
+	// Network of remote syslog: udp, tcp or tls
+	Network string
+	// Address host:port of remote syslog
+	Address string
+	// TLSConfig of remote syslog over tls
+	TLSConfig *tls.Config
+	// Tag application name sent to syslog, default LogTag
+	Tag string
+	// Facility syslog facility, default LOG_USER
+	Facility syslog.Priority
+}
+
+// LoggerConfig configuration of golib logger
+type LoggerConfig struct {
+	Outputs []LogOutputConfig
+	// Redactor masking personal data of every entry, nil uses DefaultRedactor
+	Redactor *Redactor
+	// DisableRedaction writes entries without redaction
+	DisableRedaction bool
+}
+
+// logOutput destination of formatted entries
+type logOutput interface {
+	write(entry *log.Entry, b []byte) error
+	Close() error
+}
+
+// outputHook logrus hook writing entries into single output
+type outputHook struct {
+	levels    []log.Level
+	formatter log.Formatter
+	output    logOutput
+}
+
+// discardFormatter formatter of the root logger, every output formats entries by itself
+type discardFormatter struct{}
+
+var (
+	loggerMu      sync.RWMutex
+	logger        = log.StandardLogger()
+	loggerOutputs []logOutput
+)
+
+// currentLogger function for getting logrus logger used by golib
+func currentLogger() *log.Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// SetupLogger function for configuring outputs of golib logger,
+// previously configured outputs are flushed and closed
+// cfg LoggerConfig
+func SetupLogger(cfg LoggerConfig) error {
+	if len(cfg.Outputs) == 0 {
+		return errors.New("logger requires at least one output")
+	}
+
+	l := log.New()
+	l.Out = ioutil.Discard
+	l.Formatter = &discardFormatter{}
+	l.Level = log.PanicLevel
+
+	// redaction runs before output hooks, hooks fire in the order they are added
+	if !cfg.DisableRedaction {
+		l.AddHook(NewRedactionHook(cfg.Redactor))
+	}
+
+	outputs := make([]logOutput, 0, len(cfg.Outputs))
+	for _, oc := range cfg.Outputs {
+		if oc.Level == PanicLevel {
+			oc.Level = InfoLevel
+		}
+		if oc.Level > TraceLevel {
+			oc.Level = TraceLevel
+		}
+		if oc.Formatter == nil {
+			oc.Formatter = &log.JSONFormatter{}
+		}
+
+		output, err := newLogOutput(oc)
+		if err != nil {
+			for _, o := range outputs {
+				o.Close()
+			}
+			return err
+		}
+		outputs = append(outputs, output)
+
+		l.AddHook(&outputHook{
+			levels:    log.AllLevels[:oc.Level+1],
+			formatter: oc.Formatter,
+			output:    output,
+		})
+		if log.Level(oc.Level) > l.Level {
+			l.Level = log.Level(oc.Level)
+		}
+	}
+
+	// queued entries are bound to the previous logger, write them before its outputs are closed
+	ctx, cancel := context.WithTimeout(context.Background(), fatalFlushTimeout)
+	FlushLogs(ctx)
+	cancel()
+
+	loggerMu.Lock()
+	previous := loggerOutputs
+	logger = l
+	loggerOutputs = outputs
+	loggerMu.Unlock()
+
+	// global level follows the most verbose output unless it was set by SetLogLevel
+	setDefaultLogLevel(Level(l.Level))
+	syncLoggerLevel()
+
+	for _, o := range previous {
+		o.Close()
+	}
+	return nil
+}
+
+// closeLoggerOutputs function for closing configured outputs,
+// golib falls back to the standard logrus logger afterwards
+func closeLoggerOutputs() error {
+	loggerMu.Lock()
+	outputs := loggerOutputs
+	if outputs != nil {
+		logger = log.StandardLogger()
+	}
+	loggerOutputs = nil
+	loggerMu.Unlock()
+
+	var result error
+	for _, o := range outputs {
+		if err := o.Close(); err != nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// newLogOutput function for creating output from configuration
+func newLogOutput(cfg LogOutputConfig) (logOutput, error) {
+	tag := cfg.Tag
+	if tag == "" {
+		tag = LogTag
+	}
+	facility := cfg.Facility
+	if facility == 0 {
+		facility = syslog.LOG_USER
+	}
+
+	switch cfg.Type {
+	case LogOutputStdout:
+		return &writerOutput{w: os.Stdout}, nil
+	case LogOutputWriter:
+		if cfg.Writer == nil {
+			return nil, errors.New("writer log output requires writer")
+		}
+		return &writerOutput{w: cfg.Writer}, nil
+	case LogOutputFile:
+		return newFileOutput(cfg.Path)
+	case LogOutputSyslog:
+		w, err := syslog.New(facility|syslog.LOG_INFO, tag)
+		if err != nil {
+			return nil, err
+		}
+		return &syslogOutput{w: w}, nil
+	case LogOutputRemoteSyslog:
+		return newRemoteSyslogOutput(cfg.Network, cfg.Address, cfg.TLSConfig, tag, facility)
+	}
+
+	return nil, fmt.Errorf("unknown log output type %q", cfg.Type)
+}
+
+// Format function to skip formatting on the root logger
+func (f *discardFormatter) Format(entry *log.Entry) ([]byte, error) {
+	return nil, nil
+}
+
+// Levels function for getting levels handled by the output
+func (h *outputHook) Levels() []log.Level {
+	return h.levels
+}
+
+// Fire function for formatting and writing entry into the output
+func (h *outputHook) Fire(entry *log.Entry) error {
+	b, err := h.formatter.Format(entry)
+	if err != nil {
+		return err
+	}
+	return h.output.write(entry, b)
+}
+
+// writerOutput output writing into io.Writer
+type writerOutput struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func (o *writerOutput) write(entry *log.Entry, b []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, err := o.w.Write(b)
+	return err
+}
+
+func (o *writerOutput) Close() error {
+	if o.closer == nil {
+		return nil
+	}
+	return o.closer.Close()
+}
+
+// newFileOutput function for creating output appending into file
+func newFileOutput(path string) (*writerOutput, error) {
+	if path == "" {
+		return nil, errors.New("file log output requires path")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0664)
+	if err != nil {
+		return nil, err
+	}
+	return &writerOutput{w: f, closer: f}, nil
+}
+
+// syslogOutput output writing into local syslog
+type syslogOutput struct {
+	w *syslog.Writer
+}
+
+func (o *syslogOutput) write(entry *log.Entry, b []byte) error {
+	line := strings.TrimRight(string(b), "\n")
+	switch entry.Level {
+	case log.PanicLevel, log.FatalLevel:
+		return o.w.Crit(line)
+	case log.ErrorLevel:
+		return o.w.Err(line)
+	case log.WarnLevel:
+		return o.w.Warning(line)
+	case log.InfoLevel:
+		return o.w.Info(line)
+	default:
+		return o.w.Debug(line)
+	}
+}
+
+func (o *syslogOutput) Close() error {
+	return o.w.Close()
+}
+
+// remoteSyslogOutput output sending RFC 5424 messages to remote syslog
+type remoteSyslogOutput struct {
+	mu        sync.Mutex
+	network   string
+	address   string
+	tlsConfig *tls.Config
+	hostname  string
+	tag       string
+	facility  syslog.Priority
+	conn      net.Conn
+}
+
+// newRemoteSyslogOutput function for creating remote syslog output
+func newRemoteSyslogOutput(network, address string, tlsConfig *tls.Config, tag string, facility syslog.Priority) (*remoteSyslogOutput, error) {
+	switch network {
+	case "udp", "tcp", "tls":
+	default:
+		return nil, fmt.Errorf("unsupported remote syslog network %q", network)
+	}
+
+	hostname, _ := os.Hostname()
+	o := &remoteSyslogOutput{
+		network:   network,
+		address:   address,
+		tlsConfig: tlsConfig,
+		hostname:  hostname,
+		tag:       tag,
+		facility:  facility,
+	}
+	if err := o.connect(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// connect function for dialing remote syslog
+func (o *remoteSyslogOutput) connect() error {
+	var conn net.Conn
+	var err error
+	if o.network == "tls" {
+		conn, err = tls.Dial("tcp", o.address, o.tlsConfig)
+	} else {
+		conn, err = net.Dial(o.network, o.address)
+	}
+	if err != nil {
+		return err
+	}
+	o.conn = conn
+	return nil
+}
+
+// message function for building RFC 5424 message
+func (o *remoteSyslogOutput) message(entry *log.Entry, b []byte) []byte {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		o.facility|syslogSeverity(entry.Level),
+		entry.Time.Format(rfc5424Time),
+		nilValue(o.hostname),
+		nilValue(o.tag),
+		os.Getpid(),
+		strings.TrimRight(string(b), "\n"))
+
+	if o.network == "udp" {
+		return []byte(msg)
+	}
+
+	// octet counting framing of RFC 6587 for stream transports
+	return []byte(fmt.Sprintf("%d %s", len(msg), msg))
+}
+
+func (o *remoteSyslogOutput) write(entry *log.Entry, b []byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	msg := o.message(entry, b)
+	if o.conn != nil {
+		if _, err := o.conn.Write(msg); err == nil {
+			return nil
+		}
+		o.conn.Close()
+		o.conn = nil
+	}
+
+	// reconnect once when the connection is broken
+	if err := o.connect(); err != nil {
+		return err
+	}
+	_, err := o.conn.Write(msg)
+	return err
+}
+
+func (o *remoteSyslogOutput) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.conn == nil {
+		return nil
+	}
+	err := o.conn.Close()
+	o.conn = nil
+	return err
+}
+
+// syslogSeverity function for mapping logrus level into syslog severity
+func syslogSeverity(level log.Level) syslog.Priority {
+	switch level {
+	case log.PanicLevel, log.FatalLevel:
+		return syslog.LOG_CRIT
+	case log.ErrorLevel:
+		return syslog.LOG_ERR
+	case log.WarnLevel:
+		return syslog.LOG_WARNING
+	case log.InfoLevel:
+		return syslog.LOG_INFO
+	}
+	return syslog.LOG_DEBUG
+}
+
+// nilValue function for replacing empty header field with RFC 5424 NILVALUE
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Replace(s, " ", "_", -1)
+}
@@ -0,0 +1,120 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetupLogger(t *testing.T) {
+	defer closeLoggerOutputs()
+
+	t.Run("ERROR NO OUTPUT SetupLogger", func(t *testing.T) {
+		assert.Error(t, SetupLogger(LoggerConfig{}))
+	})
+
+	t.Run("ERROR UNKNOWN OUTPUT SetupLogger", func(t *testing.T) {
+		err := SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: "unknown"}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("ERROR REMOTE SYSLOG NETWORK SetupLogger", func(t *testing.T) {
+		err := SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputRemoteSyslog, Network: "unix"}}})
+		assert.Error(t, err)
+	})
+
+	t.Run("SUCCESS LEVEL PER OUTPUT SetupLogger", func(t *testing.T) {
+		info := &bytes.Buffer{}
+		debug := &bytes.Buffer{}
+		err := SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{
+			{Type: LogOutputWriter, Writer: info, Level: InfoLevel},
+			{Type: LogOutputWriter, Writer: debug, Level: DebugLevel, Formatter: &log.TextFormatter{DisableTimestamp: true}},
+		}})
+		assert.NoError(t, err)
+
+		Log(DebugLevel, "debug message", "test", "test")
+		Log(InfoLevel, "info message", "test", "test")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.NotContains(t, info.String(), "debug message")
+		assert.Contains(t, info.String(), `"msg":"info message"`)
+		assert.Contains(t, debug.String(), "msg=\"debug message\"")
+		assert.Contains(t, debug.String(), "msg=\"info message\"")
+	})
+
+	t.Run("SUCCESS FILE SetupLogger", func(t *testing.T) {
+		dir, _ := ioutil.TempDir("", "golib")
+		path := filepath.Join(dir, "logs", "app.log")
+		err := SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputFile, Path: path}}})
+		assert.NoError(t, err)
+
+		Log(WarnLevel, "file message", "test", "test")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		b, err := ioutil.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Contains(t, string(b), "file message")
+	})
+}
+
+func TestRemoteSyslogOutput(t *testing.T) {
+	entry := &log.Entry{Level: log.ErrorLevel}
+
+	t.Run("SUCCESS UDP RemoteSyslogOutput", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer conn.Close()
+
+		o, err := newRemoteSyslogOutput("udp", conn.LocalAddr().String(), nil, "app", 0)
+		assert.NoError(t, err)
+		defer o.Close()
+
+		assert.NoError(t, o.write(entry, []byte("hello\n")))
+
+		buf := make([]byte, 1024)
+		n, _, err := conn.ReadFrom(buf)
+		assert.NoError(t, err)
+		msg := string(buf[:n])
+		assert.True(t, strings.HasPrefix(msg, "<3>1 "))
+		assert.Equal(t, "app", strings.Fields(msg)[3])
+		assert.True(t, strings.HasSuffix(msg, " - - hello"))
+	})
+
+	t.Run("SUCCESS TCP RemoteSyslogOutput", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		defer ln.Close()
+
+		received := make(chan string, 1)
+		go func() {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			buf := make([]byte, 1024)
+			n, _ := c.Read(buf)
+			received <- string(buf[:n])
+		}()
+
+		o, err := newRemoteSyslogOutput("tcp", ln.Addr().String(), nil, "app", 0)
+		assert.NoError(t, err)
+		defer o.Close()
+
+		assert.NoError(t, o.write(entry, []byte("hello")))
+
+		msg := <-received
+		frame := strings.SplitN(msg, " ", 2)
+		size, _ := strconv.Atoi(frame[0])
+		assert.Equal(t, len(frame[1]), size)
+		assert.True(t, strings.HasSuffix(frame[1], "- - hello"))
+	})
+}
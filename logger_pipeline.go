@@ -0,0 +1,289 @@
+package golib
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// OverflowPolicy policy applied when the log queue is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until the queue has room
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued entry to make room for the new one
+	OverflowDropOldest
+	// OverflowDropNewest discards the new entry and keeps the queued ones
+	OverflowDropNewest
+)
+
+const (
+	// defaultLogQueueSize default capacity of the log queue
+	defaultLogQueueSize = 1024
+	// fatalFlushTimeout maximum time spent flushing queued entries before a fatal or panic entry
+	fatalFlushTimeout = 5 * time.Second
+)
+
+// LogPipelineConfig configuration of background log pipeline
+type LogPipelineConfig struct {
+	// QueueSize capacity of the queue, default 1024
+	QueueSize int
+	// Overflow policy applied when the queue is full, default OverflowBlock
+	Overflow OverflowPolicy
+}
+
+// LogPipelineStats counters of background log pipeline
+type LogPipelineStats struct {
+	Queued        int
+	Written       uint64
+	DroppedOldest uint64
+	DroppedNewest uint64
+}
+
+// logRecord entry waiting to be written by the pipeline
+type logRecord struct {
+	entry   *log.Entry
+	level   Level
+	message string
+}
+
+// logPipeline single background writer with bounded queue
+type logPipeline struct {
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	idle     *sync.Cond
+
+	overflow OverflowPolicy
+	buf      []logRecord
+	head     int
+	count    int
+	busy     bool
+	closed   bool
+	stats    LogPipelineStats
+	done     chan struct{}
+}
+
+var (
+	pipelineMu sync.Mutex
+	pipeline   *logPipeline
+)
+
+// newLogPipeline private function for creating and starting log pipeline
+func newLogPipeline(cfg LogPipelineConfig) *logPipeline {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultLogQueueSize
+	}
+
+	p := &logPipeline{
+		overflow: cfg.Overflow,
+		buf:      make([]logRecord, cfg.QueueSize),
+		done:     make(chan struct{}),
+	}
+	p.notEmpty = sync.NewCond(&p.mu)
+	p.notFull = sync.NewCond(&p.mu)
+	p.idle = sync.NewCond(&p.mu)
+
+	go p.run()
+	return p
+}
+
+// StartLogPipeline function for starting background log pipeline with the given configuration,
+// the running pipeline is drained and closed first
+func StartLogPipeline(cfg LogPipelineConfig) {
+	pipelineMu.Lock()
+	defer pipelineMu.Unlock()
+
+	if pipeline != nil {
+		pipeline.close()
+	}
+	pipeline = newLogPipeline(cfg)
+}
+
+// currentPipeline function for getting running pipeline, the default one is started on first use
+func currentPipeline() *logPipeline {
+	pipelineMu.Lock()
+	defer pipelineMu.Unlock()
+
+	if pipeline == nil {
+		pipeline = newLogPipeline(LogPipelineConfig{})
+	}
+	return pipeline
+}
+
+// FlushLogs function for waiting until every queued log entry has been written
+// ctx context.Context deadline of flushing
+func FlushLogs(ctx context.Context) error {
+	return currentPipeline().flush(ctx)
+}
+
+// CloseLogs function for writing the queued log entries, stopping the pipeline
+// and closing outputs configured by SetupLogger,
+// entries logged after closing are written synchronously
+func CloseLogs() error {
+	flushSampling()
+	currentPipeline().close()
+	return closeLoggerOutputs()
+}
+
+// GetLogPipelineStats function for getting counters of the running pipeline
+func GetLogPipelineStats() LogPipelineStats {
+	p := currentPipeline()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Queued = p.count
+	return stats
+}
+
+// dispatch function for sending entry to the pipeline,
+// entries below the level of their scope or context and entries dropped by sampling are discarded
+func dispatch(entry *log.Entry, level Level, message string) {
+	if level > FatalLevel {
+		context, _ := entry.Data["context"].(string)
+		scope, _ := entry.Data["scope"].(string)
+		if !logLevelEnabled(level, context, scope) {
+			return
+		}
+		if !sampleEntry(entry, level, message, context, scope) {
+			return
+		}
+	}
+
+	enqueueEntry(entry, level, message)
+}
+
+// enqueueEntry function for sending entry to the pipeline,
+// fatal and panic entries are written synchronously after queued entries are flushed
+func enqueueEntry(entry *log.Entry, level Level, message string) {
+	if entry.Time.IsZero() {
+		entry = entry.WithTime(time.Now())
+	}
+	p := currentPipeline()
+
+	if level <= FatalLevel {
+		ctx, cancel := context.WithTimeout(context.Background(), fatalFlushTimeout)
+		p.flush(ctx)
+		cancel()
+
+		writeEntry(entry, level, message)
+		return
+	}
+
+	record := logRecord{entry: entry, level: level, message: message}
+	if !p.enqueue(record) {
+		record.write()
+	}
+}
+
+// enqueue function for adding record to the queue, false is returned when the pipeline is closed
+func (p *logPipeline) enqueue(r logRecord) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.count == len(p.buf) && !p.closed {
+		switch p.overflow {
+		case OverflowDropNewest:
+			p.stats.DroppedNewest++
+			return true
+		case OverflowDropOldest:
+			p.buf[p.head] = logRecord{}
+			p.head = (p.head + 1) % len(p.buf)
+			p.count--
+			p.stats.DroppedOldest++
+		default:
+			p.notFull.Wait()
+		}
+	}
+
+	if p.closed {
+		return false
+	}
+
+	p.buf[(p.head+p.count)%len(p.buf)] = r
+	p.count++
+	p.notEmpty.Signal()
+	return true
+}
+
+// run function for writing queued records until the pipeline is closed and drained
+func (p *logPipeline) run() {
+	defer close(p.done)
+
+	for {
+		p.mu.Lock()
+		for p.count == 0 && !p.closed {
+			p.notEmpty.Wait()
+		}
+		if p.count == 0 {
+			p.idle.Broadcast()
+			p.mu.Unlock()
+			return
+		}
+
+		r := p.buf[p.head]
+		p.buf[p.head] = logRecord{}
+		p.head = (p.head + 1) % len(p.buf)
+		p.count--
+		p.busy = true
+		p.notFull.Signal()
+		p.mu.Unlock()
+
+		r.write()
+
+		p.mu.Lock()
+		p.busy = false
+		p.stats.Written++
+		if p.count == 0 {
+			p.idle.Broadcast()
+		}
+		p.mu.Unlock()
+	}
+}
+
+// flush function for waiting until the queue is empty and the worker is idle
+func (p *logPipeline) flush(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		p.mu.Lock()
+		for p.count > 0 || p.busy {
+			p.idle.Wait()
+		}
+		p.mu.Unlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// close function for stopping the pipeline after the queue is drained
+func (p *logPipeline) close() {
+	p.mu.Lock()
+	p.closed = true
+	p.notEmpty.Broadcast()
+	p.notFull.Broadcast()
+	p.mu.Unlock()
+
+	<-p.done
+}
+
+// write function for writing record, panics raised by hooks or formatters are printed
+func (r logRecord) write() {
+	defer func() {
+		if rec := recover(); rec != nil {
+			fmt.Println(rec)
+		}
+	}()
+
+	writeEntry(r.entry, r.level, r.message)
+}
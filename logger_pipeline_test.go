@@ -0,0 +1,137 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingWriter writer which waits for release before accepting writes
+type blockingWriter struct {
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{}
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *blockingWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String()
+}
+
+func newPipelineTestEntry(w *blockingWriter) *log.Entry {
+	logger := log.New()
+	logger.Out = w
+	logger.Formatter = &log.TextFormatter{DisableTimestamp: true}
+	return log.NewEntry(logger)
+}
+
+func TestLogPipeline(t *testing.T) {
+	t.Run("ORDER & FLUSH LogPipeline", func(t *testing.T) {
+		w := &blockingWriter{release: make(chan struct{})}
+		close(w.release)
+		entry := newPipelineTestEntry(w)
+
+		p := newLogPipeline(LogPipelineConfig{QueueSize: 2})
+		defer p.close()
+
+		for _, m := range []string{"one", "two", "three", "four"} {
+			assert.True(t, p.enqueue(logRecord{entry: entry, level: InfoLevel, message: m}))
+		}
+		assert.NoError(t, p.flush(context.Background()))
+
+		out := w.String()
+		assert.True(t, strings.Index(out, "one") < strings.Index(out, "two"))
+		assert.True(t, strings.Index(out, "three") < strings.Index(out, "four"))
+		assert.Equal(t, uint64(4), p.stats.Written)
+	})
+
+	t.Run("DROP NEWEST LogPipeline", func(t *testing.T) {
+		w := &blockingWriter{release: make(chan struct{})}
+		entry := newPipelineTestEntry(w)
+
+		p := newLogPipeline(LogPipelineConfig{QueueSize: 1, Overflow: OverflowDropNewest})
+		p.enqueue(logRecord{entry: entry, level: InfoLevel, message: "first"})
+		waitForBusy(p)
+		p.enqueue(logRecord{entry: entry, level: InfoLevel, message: "second"})
+		p.enqueue(logRecord{entry: entry, level: InfoLevel, message: "third"})
+		close(w.release)
+		p.close()
+
+		assert.Equal(t, uint64(1), p.stats.DroppedNewest)
+		assert.Contains(t, w.String(), "second")
+		assert.NotContains(t, w.String(), "third")
+	})
+
+	t.Run("DROP OLDEST LogPipeline", func(t *testing.T) {
+		w := &blockingWriter{release: make(chan struct{})}
+		entry := newPipelineTestEntry(w)
+
+		p := newLogPipeline(LogPipelineConfig{QueueSize: 1, Overflow: OverflowDropOldest})
+		p.enqueue(logRecord{entry: entry, level: InfoLevel, message: "first"})
+		waitForBusy(p)
+		p.enqueue(logRecord{entry: entry, level: InfoLevel, message: "second"})
+		p.enqueue(logRecord{entry: entry, level: InfoLevel, message: "third"})
+		close(w.release)
+		p.close()
+
+		assert.Equal(t, uint64(1), p.stats.DroppedOldest)
+		assert.NotContains(t, w.String(), "second")
+		assert.Contains(t, w.String(), "third")
+	})
+
+	t.Run("FLUSH TIMEOUT LogPipeline", func(t *testing.T) {
+		w := &blockingWriter{release: make(chan struct{})}
+		entry := newPipelineTestEntry(w)
+
+		p := newLogPipeline(LogPipelineConfig{QueueSize: 1})
+		p.enqueue(logRecord{entry: entry, level: InfoLevel, message: "first"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.Equal(t, context.DeadlineExceeded, p.flush(ctx))
+
+		close(w.release)
+		p.close()
+	})
+
+	t.Run("CLOSED LogPipeline", func(t *testing.T) {
+		p := newLogPipeline(LogPipelineConfig{})
+		p.close()
+		assert.False(t, p.enqueue(logRecord{}))
+	})
+}
+
+func waitForBusy(p *logPipeline) {
+	for {
+		p.mu.Lock()
+		busy := p.busy
+		p.mu.Unlock()
+		if busy {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFlushLogs(t *testing.T) {
+	t.Run("SUCCESS FlushLogs", func(t *testing.T) {
+		StartLogPipeline(LogPipelineConfig{QueueSize: 16, Overflow: OverflowDropNewest})
+		Log(InfoLevel, "test", "test", "test")
+		assert.NoError(t, FlushLogs(context.Background()))
+		assert.Equal(t, 0, GetLogPipelineStats().Queued)
+	})
+}
@@ -0,0 +1,279 @@
+package golib
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileRotationConfig rotation and retention policy of files written by FileResultLogger,
+// zero values disable the corresponding limit
+type FileRotationConfig struct {
+	// MaxSize size in bytes after which the active request/response file is rotated
+	MaxSize int64
+	// MaxAge age after which the active request/response file is rotated
+	MaxAge time.Duration
+	// Compress gzip rotated files
+	Compress bool
+	// MaxFiles maximum number of files kept per code
+	MaxFiles int
+	// Retention files older than retention are removed
+	Retention time.Duration
+	// MaxTotalBytes maximum total size of files kept per code
+	MaxTotalBytes int64
+}
+
+// retentionJob cleanup of files belonging to single code
+type retentionJob struct {
+	code   string
+	dir    string
+	active string
+	match  func(name string) bool
+	cfg    FileRotationConfig
+}
+
+var (
+	fileRotationMu  sync.Mutex
+	fileRotationCfg *FileRotationConfig
+
+	// fileLocks serialize writers of the same file
+	fileLocksMu sync.Mutex
+	fileLocks   = map[string]*sync.Mutex{}
+
+	// cleanupPending deduplicates background cleanup per code, cleanupLast throttles it to once per cleanupInterval
+	cleanupMu       sync.Mutex
+	cleanupPending  = map[string]bool{}
+	cleanupLast     = map[string]time.Time{}
+	cleanupInterval = time.Minute
+	cleanupWG       sync.WaitGroup
+)
+
+// FileRotationConfigFromEnv function for reading rotation policy from environment:
+// LOG_MAX_SIZE_MB, LOG_MAX_AGE_HOURS, LOG_COMPRESS, LOG_MAX_FILES, LOG_RETENTION_DAYS and LOG_MAX_TOTAL_MB
+func FileRotationConfigFromEnv() FileRotationConfig {
+	maxSize, _ := strconv.ParseInt(os.Getenv("LOG_MAX_SIZE_MB"), 10, 64)
+	maxAge, _ := strconv.Atoi(os.Getenv("LOG_MAX_AGE_HOURS"))
+	compress, _ := strconv.ParseBool(os.Getenv("LOG_COMPRESS"))
+	maxFiles, _ := strconv.Atoi(os.Getenv("LOG_MAX_FILES"))
+	retention, _ := strconv.Atoi(os.Getenv("LOG_RETENTION_DAYS"))
+	maxTotal, _ := strconv.ParseInt(os.Getenv("LOG_MAX_TOTAL_MB"), 10, 64)
+
+	return FileRotationConfig{
+		MaxSize:       maxSize * 1024 * 1024,
+		MaxAge:        time.Duration(maxAge) * time.Hour,
+		Compress:      compress,
+		MaxFiles:      maxFiles,
+		Retention:     time.Duration(retention) * 24 * time.Hour,
+		MaxTotalBytes: maxTotal * 1024 * 1024,
+	}
+}
+
+// SetFileRotationConfig function for overriding rotation policy read from environment
+func SetFileRotationConfig(cfg FileRotationConfig) {
+	fileRotationMu.Lock()
+	defer fileRotationMu.Unlock()
+	fileRotationCfg = &cfg
+}
+
+// getFileRotationConfig function for getting active rotation policy
+func getFileRotationConfig() FileRotationConfig {
+	fileRotationMu.Lock()
+	defer fileRotationMu.Unlock()
+
+	if fileRotationCfg != nil {
+		return *fileRotationCfg
+	}
+	return FileRotationConfigFromEnv()
+}
+
+// lockFile function for locking writers of the given path, returns unlock function
+func lockFile(path string) func() {
+	fileLocksMu.Lock()
+	mu, ok := fileLocks[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		fileLocks[path] = mu
+	}
+	fileLocksMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// appendRotating function for appending data into path, rotating it first when it exceeds the policy
+func appendRotating(path string, data []byte, cfg FileRotationConfig) error {
+	unlock := lockFile(path)
+	defer unlock()
+
+	if info, err := os.Stat(path); err == nil && shouldRotate(info, int64(len(data)), cfg) {
+		rotated := fmt.Sprintf("%s.%d", path, time.Now().UnixNano())
+		if err := os.Rename(path, rotated); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0775)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// shouldRotate function for checking whether appending n bytes breaks the rotation policy
+func shouldRotate(info os.FileInfo, n int64, cfg FileRotationConfig) bool {
+	if info.Size() == 0 {
+		return false
+	}
+	if cfg.MaxSize > 0 && info.Size()+n > cfg.MaxSize {
+		return true
+	}
+	return cfg.MaxAge > 0 && time.Since(info.ModTime()) > cfg.MaxAge
+}
+
+// scheduleCleanup function for running compression and retention of a code in background,
+// at most one cleanup per code runs at a time and at most once per cleanupInterval
+func scheduleCleanup(job retentionJob) {
+	if !job.cfg.Compress && job.cfg.MaxFiles <= 0 && job.cfg.Retention <= 0 && job.cfg.MaxTotalBytes <= 0 {
+		return
+	}
+
+	key := job.dir + "|" + job.code
+	cleanupMu.Lock()
+	if cleanupPending[key] || time.Since(cleanupLast[key]) < cleanupInterval {
+		cleanupMu.Unlock()
+		return
+	}
+	cleanupPending[key] = true
+	cleanupLast[key] = time.Now()
+	cleanupWG.Add(1)
+	cleanupMu.Unlock()
+
+	go func() {
+		defer func() {
+			cleanupMu.Lock()
+			delete(cleanupPending, key)
+			cleanupMu.Unlock()
+			cleanupWG.Done()
+		}()
+
+		if err := runCleanup(job); err != nil {
+			Log(WarnLevel, err.Error(), "file_result_logger", "cleanup")
+		}
+	}()
+}
+
+// runCleanup function for compressing rotated files and removing files outside retention
+func runCleanup(job retentionJob) error {
+	infos, err := ioutil.ReadDir(job.dir)
+	if err != nil {
+		return err
+	}
+
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() || info.Name() == filepath.Base(job.active) || !job.match(info.Name()) {
+			continue
+		}
+
+		if job.cfg.Compress && !strings.HasSuffix(info.Name(), ".gz") {
+			compressed, err := compressFile(filepath.Join(job.dir, info.Name()))
+			if err != nil {
+				return err
+			}
+			info = compressed
+		}
+		files = append(files, info)
+	}
+
+	// oldest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	var total int64
+	for _, f := range files {
+		total += f.Size()
+	}
+
+	remaining := len(files)
+	for _, f := range files {
+		expired := job.cfg.Retention > 0 && time.Since(f.ModTime()) > job.cfg.Retention
+		tooMany := job.cfg.MaxFiles > 0 && remaining > job.cfg.MaxFiles
+		tooBig := job.cfg.MaxTotalBytes > 0 && total > job.cfg.MaxTotalBytes
+		if !expired && !tooMany && !tooBig {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(job.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		remaining--
+		total -= f.Size()
+	}
+
+	return nil
+}
+
+// compressFile function for replacing file with its gzip version, modification time is preserved,
+// an existing archive is never overwritten, the file recreated after it was compressed gets a unique archive name
+func compressFile(path string) (os.FileInfo, error) {
+	// the lock is kept in fileLocks so a writer still holding it is serialized with the compression
+	unlock := lockFile(path)
+	defer unlock()
+
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	gzPath := path + ".gz"
+	dst, err := os.OpenFile(gzPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	if os.IsExist(err) {
+		gzPath = fmt.Sprintf("%s.%d.gz", path, time.Now().UnixNano())
+		dst, err = os.OpenFile(gzPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0664)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zw := gzip.NewWriter(dst)
+	zw.Name = info.Name()
+	zw.ModTime = info.ModTime()
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(gzPath)
+		return nil, err
+	}
+
+	if err := os.Chtimes(gzPath, info.ModTime(), info.ModTime()); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+	return os.Stat(gzPath)
+}
@@ -0,0 +1,165 @@
+package golib
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileRotationConfigFromEnv(t *testing.T) {
+	t.Run("SUCCESS FileRotationConfigFromEnv", func(t *testing.T) {
+		os.Setenv("LOG_MAX_SIZE_MB", "10")
+		os.Setenv("LOG_COMPRESS", "true")
+		os.Setenv("LOG_RETENTION_DAYS", "7")
+		defer func() {
+			os.Unsetenv("LOG_MAX_SIZE_MB")
+			os.Unsetenv("LOG_COMPRESS")
+			os.Unsetenv("LOG_RETENTION_DAYS")
+		}()
+
+		cfg := FileRotationConfigFromEnv()
+		assert.Equal(t, int64(10*1024*1024), cfg.MaxSize)
+		assert.True(t, cfg.Compress)
+		assert.Equal(t, 7*24*time.Hour, cfg.Retention)
+		assert.Equal(t, 0, cfg.MaxFiles)
+	})
+}
+
+func TestFileResultLogger_RequestResponseRotation(t *testing.T) {
+	storage, _ := ioutil.TempDir("", "golib")
+	defer os.RemoveAll(storage)
+	defer setCleanupInterval(0)()
+
+	base := os.Getenv("STORAGE_DIR")
+	os.Setenv("STORAGE_DIR", storage)
+	defer os.Setenv("STORAGE_DIR", base)
+
+	t.Run("SUCCESS ROTATE & COMPRESS RequestResponse", func(t *testing.T) {
+		f := newFileResultLogger(storage)
+		f.rotation = FileRotationConfig{MaxSize: 64, Compress: true, MaxFiles: 2}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f.RequestResponse("rotate", strings.Repeat("x", 30)+"\n")
+			}()
+		}
+		wg.Wait()
+		cleanupWG.Wait()
+
+		// a cleanup skipped while another one was running is covered by the next write
+		f.RequestResponse("rotate", "last\n")
+		cleanupWG.Wait()
+
+		infos, _ := ioutil.ReadDir(filepath.Join(storage, "logs"))
+		var active, compressed int
+		for _, info := range infos {
+			switch {
+			case strings.HasSuffix(info.Name(), ".rotate"):
+				active++
+			case strings.HasSuffix(info.Name(), ".gz"):
+				compressed++
+			default:
+				t.Errorf("unexpected file %s", info.Name())
+			}
+		}
+		assert.Equal(t, 1, active)
+		assert.Equal(t, 2, compressed)
+	})
+
+	t.Run("EXISTING ARCHIVE RequestResponse", func(t *testing.T) {
+		f := newFileResultLogger(storage)
+		f.rotation = FileRotationConfig{Compress: true}
+
+		dir := filepath.Join(storage, "logs")
+		yesterday := filepath.Join(dir, "20200101.archive")
+		assert.NoError(t, ioutil.WriteFile(yesterday+".gz", []byte("archived"), 0664))
+		assert.NoError(t, ioutil.WriteFile(yesterday, []byte("written after compression\n"), 0664))
+
+		f.RequestResponse("archive", "today\n")
+		cleanupWG.Wait()
+
+		archived, err := ioutil.ReadFile(yesterday + ".gz")
+		assert.NoError(t, err)
+		assert.Equal(t, "archived", string(archived))
+		_, err = os.Stat(yesterday)
+		assert.True(t, os.IsNotExist(err))
+
+		matches, _ := filepath.Glob(yesterday + ".*.gz")
+		assert.Len(t, matches, 1)
+	})
+}
+
+func TestScheduleCleanupThrottle(t *testing.T) {
+	storage, _ := ioutil.TempDir("", "golib")
+	defer os.RemoveAll(storage)
+	defer setCleanupInterval(time.Hour)()
+
+	t.Run("THROTTLED scheduleCleanup", func(t *testing.T) {
+		f := newFileResultLogger(storage)
+		f.rotation = FileRotationConfig{MaxFiles: 1}
+
+		for i := 0; i < 3; i++ {
+			f.Store("throttle", []byte("payload"))
+			cleanupWG.Wait()
+		}
+
+		infos, _ := ioutil.ReadDir(filepath.Join(storage, "throttle"))
+		assert.Len(t, infos, 3)
+	})
+}
+
+// setCleanupInterval function for overriding cleanupInterval in tests, returns function restoring it
+func setCleanupInterval(d time.Duration) func() {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	previous := cleanupInterval
+	cleanupInterval = d
+	return func() {
+		cleanupMu.Lock()
+		cleanupInterval = previous
+		cleanupMu.Unlock()
+	}
+}
+
+func TestFileResultLogger_StoreRetention(t *testing.T) {
+	storage, _ := ioutil.TempDir("", "golib")
+	defer os.RemoveAll(storage)
+	defer setCleanupInterval(0)()
+
+	t.Run("SUCCESS MAX FILES Store", func(t *testing.T) {
+		f := newFileResultLogger(storage)
+		f.rotation = FileRotationConfig{MaxFiles: 3}
+
+		names := map[string]bool{}
+		for i := 0; i < 5; i++ {
+			names[f.Store("order", []byte("payload"))] = true
+			cleanupWG.Wait()
+		}
+		assert.Len(t, names, 5)
+
+		infos, _ := ioutil.ReadDir(filepath.Join(storage, "order"))
+		assert.Len(t, infos, 3)
+	})
+
+	t.Run("SUCCESS MAX TOTAL BYTES Store", func(t *testing.T) {
+		f := newFileResultLogger(storage)
+		f.rotation = FileRotationConfig{MaxTotalBytes: 10}
+
+		f.Store("bytes", []byte("12345678"))
+		cleanupWG.Wait()
+		f.Store("bytes", []byte("12345678"))
+		cleanupWG.Wait()
+
+		infos, _ := ioutil.ReadDir(filepath.Join(storage, "bytes"))
+		assert.Len(t, infos, 1)
+	})
+}
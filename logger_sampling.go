@@ -0,0 +1,198 @@
+package golib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxSamplingKeys number of rate limit windows kept before stale ones are purged,
+	// also the number of open deduplication windows and of keys counted by RateLimitedByKey
+	maxSamplingKeys = 10000
+	// otherSamplingKey key of RateLimitedByKey counting entries of keys over maxSamplingKeys
+	otherSamplingKey = "other"
+)
+
+// LogSamplingConfig deduplication and rate limiting of Log, LogCtx and LogError entries,
+// zero values disable the corresponding feature
+type LogSamplingConfig struct {
+	// DedupWindow identical (context, scope, message) entries inside the window collapse into the first entry,
+	// written when the window ends with repeated=N when it occurred N > 1 times
+	DedupWindow time.Duration
+	// RateLimit maximum entries per (context, scope) key inside RateInterval
+	RateLimit int
+	// RateInterval window of RateLimit, default one second
+	RateInterval time.Duration
+	// RateLimits per-key limits overriding RateLimit, keyed by scope or context value
+	RateLimits map[string]int
+}
+
+// LogSamplingStats counters of entries dropped by sampling
+type LogSamplingStats struct {
+	// Deduplicated entries collapsed into a repeated=N entry
+	Deduplicated uint64
+	// RateLimited entries dropped by rate limits
+	RateLimited uint64
+	// RateLimitedByKey entries dropped by rate limits per "context|scope" key,
+	// keys over maxSamplingKeys are counted as "other"
+	RateLimitedByKey map[string]uint64
+}
+
+// dedupState first entry of a key held until the current window ends
+type dedupState struct {
+	entry   *log.Entry
+	level   Level
+	message string
+	count   int
+	timer   *time.Timer
+}
+
+// rateState entries of a key written inside the current window
+type rateState struct {
+	start time.Time
+	count int
+}
+
+var (
+	samplingMu  sync.Mutex
+	samplingCfg LogSamplingConfig
+	dedupStates = map[string]*dedupState{}
+	rateStates  = map[string]*rateState{}
+	samplingSt  = LogSamplingStats{RateLimitedByKey: map[string]uint64{}}
+)
+
+// SetLogSampling function for configuring deduplication and rate limiting,
+// entries held by the previous configuration are written first
+func SetLogSampling(cfg LogSamplingConfig) {
+	flushSampling()
+
+	if cfg.RateInterval <= 0 {
+		cfg.RateInterval = time.Second
+	}
+
+	samplingMu.Lock()
+	samplingCfg = cfg
+	rateStates = map[string]*rateState{}
+	samplingMu.Unlock()
+}
+
+// GetLogSamplingStats function for getting counters of entries dropped by sampling
+func GetLogSamplingStats() LogSamplingStats {
+	samplingMu.Lock()
+	defer samplingMu.Unlock()
+
+	stats := samplingSt
+	stats.RateLimitedByKey = make(map[string]uint64, len(samplingSt.RateLimitedByKey))
+	for k, v := range samplingSt.RateLimitedByKey {
+		stats.RateLimitedByKey[k] = v
+	}
+	return stats
+}
+
+// sampleEntry function for checking whether entry is written now,
+// false is returned for entries held or suppressed by deduplication and entries dropped by rate limits
+func sampleEntry(entry *log.Entry, level Level, message, context, scope string) bool {
+	samplingMu.Lock()
+	defer samplingMu.Unlock()
+
+	cfg := samplingCfg
+	dedupKey := ""
+	if cfg.DedupWindow > 0 {
+		dedupKey = fmt.Sprintf("%s|%s|%s|%v", context, scope, message, entry.Data["error"])
+		if state, ok := dedupStates[dedupKey]; ok {
+			state.count++
+			samplingSt.Deduplicated++
+			return false
+		}
+	}
+
+	if !allowRate(cfg, context, scope) {
+		return false
+	}
+	if dedupKey == "" || len(dedupStates) >= maxSamplingKeys {
+		return true
+	}
+
+	state := &dedupState{entry: entry.WithTime(time.Now()), level: level, message: message, count: 1}
+	state.timer = time.AfterFunc(cfg.DedupWindow, func() {
+		samplingMu.Lock()
+		if dedupStates[dedupKey] != state {
+			samplingMu.Unlock()
+			return
+		}
+		delete(dedupStates, dedupKey)
+		samplingMu.Unlock()
+		state.write()
+	})
+	dedupStates[dedupKey] = state
+	return false
+}
+
+// allowRate function for checking rate limit of (context, scope) key, caller holds samplingMu
+func allowRate(cfg LogSamplingConfig, context, scope string) bool {
+	limit := cfg.RateLimit
+	if l, ok := cfg.RateLimits[scope]; ok && scope != "" {
+		limit = l
+	} else if l, ok := cfg.RateLimits[context]; ok && context != "" {
+		limit = l
+	}
+	if limit <= 0 {
+		return true
+	}
+
+	key := context + "|" + scope
+	now := time.Now()
+	state, ok := rateStates[key]
+	if !ok || now.Sub(state.start) >= cfg.RateInterval {
+		if !ok && len(rateStates) >= maxSamplingKeys {
+			purgeRateStates(now, cfg.RateInterval)
+		}
+		state = &rateState{start: now}
+		rateStates[key] = state
+	}
+
+	if state.count >= limit {
+		samplingSt.RateLimited++
+		if _, ok := samplingSt.RateLimitedByKey[key]; !ok && len(samplingSt.RateLimitedByKey) >= maxSamplingKeys {
+			key = otherSamplingKey
+		}
+		samplingSt.RateLimitedByKey[key]++
+		return false
+	}
+	state.count++
+	return true
+}
+
+// purgeRateStates function for removing windows which already ended, caller holds samplingMu
+func purgeRateStates(now time.Time, interval time.Duration) {
+	for k, s := range rateStates {
+		if now.Sub(s.start) >= interval {
+			delete(rateStates, k)
+		}
+	}
+}
+
+// flushSampling function for writing entries of every open deduplication window
+func flushSampling() {
+	samplingMu.Lock()
+	states := dedupStates
+	dedupStates = map[string]*dedupState{}
+	samplingMu.Unlock()
+
+	for _, state := range states {
+		state.timer.Stop()
+		state.write()
+	}
+}
+
+// write function for writing the held entry with the number of repetitions
+func (s *dedupState) write() {
+	entry := s.entry
+	if s.count > 1 {
+		entry = entry.WithField("repeated", s.count)
+	}
+	enqueueEntry(entry, s.level, s.message)
+}
@@ -0,0 +1,101 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetLogSampling(t *testing.T) {
+	defer closeLoggerOutputs()
+	defer SetLogSampling(LogSamplingConfig{})
+	defer resetLogLevels()
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf}}}))
+
+	t.Run("DEDUP SetLogSampling", func(t *testing.T) {
+		buf.Reset()
+		SetLogSampling(LogSamplingConfig{DedupWindow: time.Hour})
+		before := GetLogSamplingStats()
+
+		for i := 0; i < 5; i++ {
+			LogError(errors.New("connection refused"), "dedup", "payload")
+		}
+		LogError(errors.New("timeout"), "dedup", "payload")
+		flushSampling()
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		assert.Len(t, lines, 2)
+		assert.Equal(t, 1, strings.Count(buf.String(), `"repeated":5`))
+		assert.Equal(t, 1, strings.Count(buf.String(), `"repeated"`))
+		assert.Equal(t, uint64(4), GetLogSamplingStats().Deduplicated-before.Deduplicated)
+	})
+
+	t.Run("DEDUP WINDOW END SetLogSampling", func(t *testing.T) {
+		buf.Reset()
+		SetLogSampling(LogSamplingConfig{DedupWindow: 20 * time.Millisecond})
+
+		Log(InfoLevel, "window", "dedup", "window")
+		Log(InfoLevel, "window", "dedup", "window")
+		samplingMu.Lock()
+		held := len(dedupStates)
+		samplingMu.Unlock()
+		assert.Equal(t, 1, held)
+
+		time.Sleep(60 * time.Millisecond)
+		assert.NoError(t, FlushLogs(context.Background()))
+		assert.Equal(t, 1, strings.Count(buf.String(), `"msg":"window"`))
+		assert.Contains(t, buf.String(), `"repeated":2`)
+	})
+
+	t.Run("RATE LIMIT SetLogSampling", func(t *testing.T) {
+		buf.Reset()
+		SetLogSampling(LogSamplingConfig{RateLimit: 2, RateInterval: time.Hour, RateLimits: map[string]int{"vip": 4}})
+		before := GetLogSamplingStats()
+
+		for i := 0; i < 5; i++ {
+			Log(InfoLevel, "limited", "rate", "normal")
+			Log(InfoLevel, "limited", "rate", "vip")
+		}
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		stats := GetLogSamplingStats()
+		assert.Equal(t, 6, strings.Count(buf.String(), `"msg":"limited"`))
+		assert.Equal(t, uint64(4), stats.RateLimited-before.RateLimited)
+		assert.Equal(t, uint64(3), stats.RateLimitedByKey["rate|normal"]-before.RateLimitedByKey["rate|normal"])
+		assert.Equal(t, uint64(1), stats.RateLimitedByKey["rate|vip"]-before.RateLimitedByKey["rate|vip"])
+	})
+
+	t.Run("RATE LIMIT KEYS CAPPED SetLogSampling", func(t *testing.T) {
+		SetLogSampling(LogSamplingConfig{RateLimit: 1, RateInterval: time.Hour})
+		samplingMu.Lock()
+		saved := samplingSt.RateLimitedByKey
+		samplingSt.RateLimitedByKey = map[string]uint64{}
+		for i := 0; i < maxSamplingKeys; i++ {
+			samplingSt.RateLimitedByKey[strconv.Itoa(i)] = 1
+		}
+		samplingMu.Unlock()
+		defer func() {
+			samplingMu.Lock()
+			samplingSt.RateLimitedByKey = saved
+			samplingMu.Unlock()
+		}()
+
+		Log(InfoLevel, "capped", "rate", "dynamic-1")
+		Log(InfoLevel, "capped", "rate", "dynamic-1")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		stats := GetLogSamplingStats()
+		assert.Len(t, stats.RateLimitedByKey, maxSamplingKeys+1)
+		assert.Equal(t, uint64(1), stats.RateLimitedByKey[otherSamplingKey])
+		assert.NotContains(t, stats.RateLimitedByKey, "rate|dynamic-1")
+	})
+}
@@ -113,7 +113,9 @@ func TestLog(t *testing.T) {
 
 	t.Run("PanicLevel LOG", func(t *testing.T) {
 		l = PanicLevel
-		Log(l, m, c, s, customTag)
+		assert.Panics(t, func() {
+			Log(l, m, c, s, customTag)
+		})
 	})
 
 }
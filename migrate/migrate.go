@@ -0,0 +1,379 @@
+// Package migrate runs versioned sql migrations read from NNN_name.up.sql and NNN_name.down.sql files,
+// applied versions are recorded in a table and concurrent runs are serialized by a postgres advisory lock
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Bhinneka/golib"
+)
+
+const (
+	// DefaultTable table recording applied versions
+	DefaultTable = "schema_migrations"
+	// NoTransaction marker on the first line of a file running it outside transaction, e.g. CREATE INDEX CONCURRENTLY
+	NoTransaction = "-- migrate:no-transaction"
+)
+
+// fileRegexp name of migration file
+var fileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// ErrNoChange no migration was applied or rolled back
+var ErrNoChange = errors.New("no change")
+
+// Migration single version
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status state of a migration
+type Status struct {
+	Version   uint64     `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// Config configuration of Migrator
+type Config struct {
+	// Dir directory of migration files
+	Dir string
+	// Table table recording applied versions, default DefaultTable
+	Table string
+	// Dialect dialect of the database, only postgres is supported, empty means postgres
+	Dialect golib.DBDialect
+}
+
+// Migrator runner of migrations
+type Migrator struct {
+	db         *sql.DB
+	table      string
+	lockKey    int64
+	migrations []Migration
+}
+
+// Load function for reading migrations of dir ordered by version
+// dir string directory of migration files
+func Load(dir string) ([]Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[uint64]*Migration{}
+	for _, f := range files {
+		m := fileRegexp.FindStringSubmatch(f.Name())
+		if f.IsDir() || m == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version of %s: %v", f.Name(), err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("version %d is used by %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(b)
+		} else {
+			migration.Down = string(b)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// New function for creating migrator of migrations in cfg.Dir
+// db *sql.DB
+// cfg Config
+func New(db *sql.DB, cfg Config) (*Migrator, error) {
+	if cfg.Dialect != "" && cfg.Dialect != golib.DBDialectPostgres {
+		return nil, fmt.Errorf("unsupported migration dialect %q, only postgres is supported", cfg.Dialect)
+	}
+
+	migrations, err := Load(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMigrations(db, cfg.Table, migrations), nil
+}
+
+// NewWithMigrations function for creating migrator of migrations loaded elsewhere, db must be postgres
+// db *sql.DB
+// table string table recording applied versions, empty uses DefaultTable
+// migrations []Migration
+func NewWithMigrations(db *sql.DB, table string, migrations []Migration) *Migrator {
+	if table == "" {
+		table = DefaultTable
+	}
+
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	h := fnv.New64a()
+	h.Write([]byte("golib/migrate:" + table))
+	return &Migrator{db: db, table: table, lockKey: int64(h.Sum64()), migrations: sorted}
+}
+
+// Up function for applying every pending migration
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	return m.run(ctx, func(applied map[uint64]time.Time) ([]Migration, bool) {
+		var plan []Migration
+		for _, mg := range m.migrations {
+			if _, ok := applied[mg.Version]; !ok {
+				plan = append(plan, mg)
+			}
+		}
+		return plan, true
+	})
+}
+
+// Down function for rolling back the latest applied migrations
+// steps int number of migrations rolled back, at least one
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if steps < 1 {
+		steps = 1
+	}
+	return m.run(ctx, func(applied map[uint64]time.Time) ([]Migration, bool) {
+		var plan []Migration
+		for i := len(m.migrations) - 1; i >= 0 && len(plan) < steps; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok {
+				plan = append(plan, m.migrations[i])
+			}
+		}
+		return plan, false
+	})
+}
+
+// Goto function for migrating up or down until version is the latest applied migration,
+// version zero rolls back every migration, the direction is chosen under the migration lock
+// version uint64
+func (m *Migrator) Goto(ctx context.Context, version uint64) ([]Migration, error) {
+	if version != 0 && m.find(version) == nil {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.run(ctx, func(applied map[uint64]time.Time) ([]Migration, bool) {
+		var current uint64
+		for v := range applied {
+			if v > current {
+				current = v
+			}
+		}
+
+		var plan []Migration
+		if version >= current {
+			for _, mg := range m.migrations {
+				if _, ok := applied[mg.Version]; !ok && mg.Version <= version {
+					plan = append(plan, mg)
+				}
+			}
+			return plan, true
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			if _, ok := applied[m.migrations[i].Version]; ok && m.migrations[i].Version > version {
+				plan = append(plan, m.migrations[i])
+			}
+		}
+		return plan, false
+	})
+}
+
+// Status function for getting state of every migration, versions recorded without file are included
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, names, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	seen := map[uint64]bool{}
+	for _, mg := range m.migrations {
+		s := Status{Version: mg.Version, Name: mg.Name}
+		if at, ok := applied[mg.Version]; ok {
+			at := at
+			s.Applied, s.AppliedAt = true, &at
+		}
+		seen[mg.Version] = true
+		statuses = append(statuses, s)
+	}
+	for version, at := range applied {
+		if !seen[version] {
+			at := at
+			statuses = append(statuses, Status{Version: version, Name: names[version], Applied: true, AppliedAt: &at})
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// run function for executing plan under the migration lock
+func (m *Migrator) run(ctx context.Context, plan func(applied map[uint64]time.Time) ([]Migration, bool)) ([]Migration, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", m.lockKey); err != nil {
+		return nil, fmt.Errorf("failed to take migration lock: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockKey)
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	// versions are read after the lock is taken so a concurrent run is never repeated
+	applied, _, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, up := plan(applied)
+	if len(migrations) == 0 {
+		return nil, ErrNoChange
+	}
+
+	done := make([]Migration, 0, len(migrations))
+	for _, mg := range migrations {
+		if err := m.apply(ctx, conn, mg, up); err != nil {
+			return done, err
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// apply function for running a single migration and recording its version
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mg Migration, up bool) error {
+	query, direction := mg.Up, "up"
+	record, args := fmt.Sprintf("INSERT INTO %s (version, name) VALUES ($1, $2)", m.table), []interface{}{mg.Version, mg.Name}
+	if !up {
+		if mg.Down == "" {
+			return fmt.Errorf("migration %d_%s has no down file", mg.Version, mg.Name)
+		}
+		query, direction = mg.Down, "down"
+		record, args = fmt.Sprintf("DELETE FROM %s WHERE version = $1", m.table), []interface{}{mg.Version}
+	}
+
+	start := time.Now()
+	if strings.HasPrefix(strings.TrimSpace(query), NoTransaction) {
+		if _, err := conn.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("migration %d_%s %s failed: %v", mg.Version, mg.Name, direction, err)
+		}
+		if _, err := conn.ExecContext(ctx, record, args...); err != nil {
+			return err
+		}
+	} else {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d_%s %s failed: %v", mg.Version, mg.Name, direction, err)
+		}
+		if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	golib.LogCtx(ctx, golib.InfoLevel, fmt.Sprintf("migration %d_%s %s applied in %s", mg.Version, mg.Name, direction, time.Since(start)),
+		"migrate", direction, map[string]interface{}{"version": mg.Version})
+	return nil
+}
+
+// ensureTable function for creating table recording applied versions
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	version BIGINT PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`, m.table))
+	return err
+}
+
+// applied function for reading applied versions
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[uint64]time.Time, map[uint64]string, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT version, name, applied_at FROM %s", m.table))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	applied := map[uint64]time.Time{}
+	names := map[uint64]string{}
+	for rows.Next() {
+		var version uint64
+		var name string
+		var at time.Time
+		if err := rows.Scan(&version, &name, &at); err != nil {
+			return nil, nil, err
+		}
+		applied[version], names[version] = at, name
+	}
+	return applied, names, rows.Err()
+}
+
+// find function for getting migration of version
+func (m *Migrator) find(version uint64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
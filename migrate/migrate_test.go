@@ -0,0 +1,298 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Bhinneka/golib"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeMigrations(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("SUCCESS Load", func(t *testing.T) {
+		dir := writeMigrations(t, map[string]string{
+			"002_add_status.up.sql":      "ALTER TABLE orders ADD status TEXT",
+			"002_add_status.down.sql":    "ALTER TABLE orders DROP status",
+			"001_create_orders.up.sql":   "CREATE TABLE orders (id INT)",
+			"001_create_orders.down.sql": "DROP TABLE orders",
+			"README.md":                  "ignored",
+		})
+		defer os.RemoveAll(dir)
+		os.Mkdir(filepath.Join(dir, "003_dir.up.sql"), 0755)
+
+		migrations, err := Load(dir)
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{
+			{Version: 1, Name: "create_orders", Up: "CREATE TABLE orders (id INT)", Down: "DROP TABLE orders"},
+			{Version: 2, Name: "add_status", Up: "ALTER TABLE orders ADD status TEXT", Down: "ALTER TABLE orders DROP status"},
+		}, migrations)
+	})
+
+	t.Run("DUPLICATE VERSION Load", func(t *testing.T) {
+		dir := writeMigrations(t, map[string]string{
+			"001_create_orders.up.sql": "CREATE TABLE orders (id INT)",
+			"1_create_users.up.sql":    "CREATE TABLE users (id INT)",
+		})
+		defer os.RemoveAll(dir)
+
+		_, err := Load(dir)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "version 1 is used by")
+	})
+
+	t.Run("MISSING UP Load", func(t *testing.T) {
+		dir := writeMigrations(t, map[string]string{
+			"001_create_orders.down.sql": "DROP TABLE orders",
+		})
+		defer os.RemoveAll(dir)
+
+		_, err := Load(dir)
+		assert.EqualError(t, err, "migration 1_create_orders has no up file")
+	})
+
+	t.Run("INVALID VERSION Load", func(t *testing.T) {
+		dir := writeMigrations(t, map[string]string{
+			"99999999999999999999_overflow.up.sql": "SELECT 1",
+		})
+		defer os.RemoveAll(dir)
+
+		_, err := Load(dir)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid version of 99999999999999999999_overflow.up.sql")
+	})
+
+	t.Run("ERROR Load", func(t *testing.T) {
+		_, err := Load(filepath.Join(os.TempDir(), "golib-migrate-missing"))
+		assert.Error(t, err)
+	})
+}
+
+func TestNew(t *testing.T) {
+	dir := writeMigrations(t, map[string]string{"001_create_orders.up.sql": "CREATE TABLE orders (id INT)"})
+	defer os.RemoveAll(dir)
+
+	t.Run("SUCCESS New", func(t *testing.T) {
+		m, err := New(nil, Config{Dir: dir, Dialect: golib.DBDialectPostgres})
+		assert.NoError(t, err)
+		assert.Equal(t, DefaultTable, m.table)
+		assert.Len(t, m.migrations, 1)
+	})
+
+	t.Run("UNSUPPORTED DIALECT New", func(t *testing.T) {
+		_, err := New(nil, Config{Dir: dir, Dialect: golib.DBDialectMySQL})
+		assert.EqualError(t, err, `unsupported migration dialect "mysql", only postgres is supported`)
+	})
+}
+
+var testMigrations = []Migration{
+	{Version: 3, Name: "add_index", Up: NoTransaction + "\nCREATE INDEX CONCURRENTLY orders_status ON orders (status)", Down: "DROP INDEX orders_status"},
+	{Version: 1, Name: "create_orders", Up: "CREATE TABLE orders (id INT)", Down: "DROP TABLE orders"},
+	{Version: 2, Name: "add_status", Up: "ALTER TABLE orders ADD status TEXT", Down: "ALTER TABLE orders DROP status"},
+}
+
+// expectRun function for expecting lock, table and applied versions of a run
+func expectRun(mock sqlmock.Sqlmock, m *Migrator, applied ...uint64) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(m.lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectApplied(mock, applied...)
+}
+
+// expectApplied function for expecting table creation and applied versions
+func expectApplied(mock sqlmock.Sqlmock, applied ...uint64) {
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "name", "applied_at"})
+	for _, v := range applied {
+		rows.AddRow(v, "migration", time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery("SELECT version, name, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+// expectUnlock function for expecting release of the migration lock
+func expectUnlock(mock sqlmock.Sqlmock, m *Migrator) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(m.lockKey).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectUp function for expecting migration applied in transaction
+func expectUp(mock sqlmock.Sqlmock, mg Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(mg.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)")).
+		WithArgs(int64(mg.Version), mg.Name).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// expectDown function for expecting migration rolled back in transaction
+func expectDown(mock sqlmock.Sqlmock, mg Migration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(mg.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).
+		WithArgs(int64(mg.Version)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func newTestMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewWithMigrations(db, "", testMigrations), mock
+}
+
+func TestMigratorUp(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SUCCESS Up", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		expectRun(mock, m, 1)
+		expectUp(mock, m.migrations[1])
+		mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX CONCURRENTLY orders_status")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations (version, name) VALUES ($1, $2)")).
+			WithArgs(int64(3), "add_index").WillReturnResult(sqlmock.NewResult(0, 1))
+		expectUnlock(mock, m)
+
+		done, err := m.Up(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{m.migrations[1], m.migrations[2]}, done)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NO CHANGE Up", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		expectRun(mock, m, 1, 2, 3)
+		expectUnlock(mock, m)
+
+		done, err := m.Up(ctx)
+		assert.Equal(t, ErrNoChange, err)
+		assert.Empty(t, done)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("ROLLBACK Up", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		expectRun(mock, m)
+		expectUp(mock, m.migrations[0])
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(m.migrations[1].Up)).WillReturnError(errors.New("column exists"))
+		mock.ExpectRollback()
+		expectUnlock(mock, m)
+
+		done, err := m.Up(ctx)
+		assert.EqualError(t, err, "migration 2_add_status up failed: column exists")
+		assert.Equal(t, []Migration{m.migrations[0]}, done)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("LOCK ERROR Up", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).WithArgs(m.lockKey).WillReturnError(errors.New("canceled"))
+
+		_, err := m.Up(ctx)
+		assert.EqualError(t, err, "failed to take migration lock: canceled")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigratorDown(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SUCCESS Down", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		expectRun(mock, m, 1, 2, 3)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta("DROP INDEX orders_status")).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).
+			WithArgs(int64(3)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		expectDown(mock, m.migrations[1])
+		expectUnlock(mock, m)
+
+		done, err := m.Down(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{m.migrations[2], m.migrations[1]}, done)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("NO DOWN FILE Down", func(t *testing.T) {
+		db, mock, _ := sqlmock.New()
+		m := NewWithMigrations(db, "", []Migration{{Version: 1, Name: "create_orders", Up: "CREATE TABLE orders (id INT)"}})
+		expectRun(mock, m, 1)
+		expectUnlock(mock, m)
+
+		_, err := m.Down(ctx, 0)
+		assert.EqualError(t, err, "migration 1_create_orders has no down file")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigratorGoto(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("UP Goto", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		expectRun(mock, m, 1)
+		expectUp(mock, m.migrations[1])
+		expectUnlock(mock, m)
+
+		done, err := m.Goto(ctx, 2)
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{m.migrations[1]}, done)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("DOWN Goto", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		expectRun(mock, m, 1, 2)
+		expectDown(mock, m.migrations[1])
+		expectDown(mock, m.migrations[0])
+		expectUnlock(mock, m)
+
+		done, err := m.Goto(ctx, 0)
+		assert.NoError(t, err)
+		assert.Equal(t, []Migration{m.migrations[1], m.migrations[0]}, done)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("UNKNOWN Goto", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		_, err := m.Goto(ctx, 9)
+		assert.EqualError(t, err, "unknown migration version 9")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMigratorStatus(t *testing.T) {
+	t.Run("SUCCESS Status", func(t *testing.T) {
+		m, mock := newTestMigrator(t)
+		expectApplied(mock, 1, 9)
+
+		statuses, err := m.Status(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, statuses, 4)
+		assert.Equal(t, []uint64{1, 2, 3, 9}, []uint64{statuses[0].Version, statuses[1].Version, statuses[2].Version, statuses[3].Version})
+		assert.True(t, statuses[0].Applied)
+		assert.NotNil(t, statuses[0].AppliedAt)
+		assert.False(t, statuses[1].Applied)
+		assert.Nil(t, statuses[1].AppliedAt)
+		assert.Equal(t, Status{Version: 9, Name: "migration", Applied: true, AppliedAt: statuses[3].AppliedAt}, statuses[3])
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,399 @@
+package golib
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RedactedValue default replacement of redacted values
+const RedactedValue = "xxxxx"
+
+var (
+	// cardNumberRegexp candidate payment card numbers, validated with luhn checksum
+	cardNumberRegexp = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// nikRegexp candidate indonesian NIK, validated with province and birth date segments
+	nikRegexp = regexp.MustCompile(`\b\d{16}\b`)
+	// phoneRegexpRedact indonesian mobile numbers and international numbers
+	phoneRegexpRedact = regexp.MustCompile(`(?:\+62|\b62|\b0)8[1-9]\d{6,10}\b|\+\d{9,15}\b`)
+	// emailRegexpRedact email addresses inside free text
+	emailRegexpRedact = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// formRegexp url encoded form body or query string
+	formRegexp = regexp.MustCompile(`^[\w.\-\[\]%+]+=[^&\s]*(?:&[\w.\-\[\]%+]+=[^&\s]*)*$`)
+
+	defaultRedactorMu sync.RWMutex
+	defaultRedactor   = NewRedactor(DefaultRedactionConfig())
+)
+
+// RedactionConfig rules of Redactor
+type RedactionConfig struct {
+	// Keys names of fields, parameters and headers whose values are always redacted,
+	// matched case-insensitively ignoring "_" and "-"
+	Keys []string
+	// Patterns regexes whose matches are redacted inside any string value
+	Patterns []*regexp.Regexp
+	// CardNumbers redact payment card numbers passing luhn checksum
+	CardNumbers bool
+	// Emails redact email addresses
+	Emails bool
+	// PhoneNumbers redact phone numbers
+	PhoneNumbers bool
+	// NIK redact indonesian national identity numbers
+	NIK bool
+	// Replacement of redacted values, default RedactedValue
+	Replacement string
+}
+
+// Redactor engine masking personal data in logs and traces
+type Redactor struct {
+	keys        map[string]struct{}
+	patterns    []*regexp.Regexp
+	cfg         RedactionConfig
+	replacement string
+}
+
+// RedactionHook logrus hook redacting message and fields of entries
+type RedactionHook struct {
+	Redactor *Redactor
+}
+
+// DefaultRedactionConfig function for getting rules used by the default redactor
+func DefaultRedactionConfig() RedactionConfig {
+	return RedactionConfig{
+		Keys: []string{
+			"password", "newPassword", "rePassword", "oldPassword", "pin", "otp", "cvv", "cvc",
+			"secret", "token", "accessToken", "refreshToken", "apiKey", "xApiKey", "authorization",
+			"proxyAuthorization", "cookie", "setCookie", "cardNumber", "nik",
+		},
+		CardNumbers:  true,
+		Emails:       true,
+		PhoneNumbers: true,
+		NIK:          true,
+	}
+}
+
+// NewRedactor function for creating redactor from rules
+func NewRedactor(cfg RedactionConfig) *Redactor {
+	r := &Redactor{
+		keys:        make(map[string]struct{}, len(cfg.Keys)),
+		patterns:    cfg.Patterns,
+		cfg:         cfg,
+		replacement: cfg.Replacement,
+	}
+	if r.replacement == "" {
+		r.replacement = RedactedValue
+	}
+	for _, k := range cfg.Keys {
+		r.keys[normalizeRedactionKey(k)] = struct{}{}
+	}
+	return r
+}
+
+// DefaultRedactor function for getting redactor used by golib logger and tracer
+func DefaultRedactor() *Redactor {
+	defaultRedactorMu.RLock()
+	defer defaultRedactorMu.RUnlock()
+	return defaultRedactor
+}
+
+// SetDefaultRedactor function for replacing redactor used by golib logger and tracer
+func SetDefaultRedactor(r *Redactor) {
+	defaultRedactorMu.Lock()
+	defaultRedactor = r
+	defaultRedactorMu.Unlock()
+}
+
+// normalizeRedactionKey function for normalizing key name before matching
+func normalizeRedactionKey(k string) string {
+	k = strings.ToLower(k)
+	k = strings.Replace(k, "_", "", -1)
+	return strings.Replace(k, "-", "", -1)
+}
+
+// IsSensitiveKey function for checking whether values of key are always redacted
+func (r *Redactor) IsSensitiveKey(k string) bool {
+	_, ok := r.keys[normalizeRedactionKey(k)]
+	return ok
+}
+
+// RedactString function for redacting detected personal data inside free text
+func (r *Redactor) RedactString(s string) string {
+	if r.cfg.CardNumbers {
+		s = cardNumberRegexp.ReplaceAllStringFunc(s, func(m string) string {
+			if luhnValid(m) {
+				return r.replacement
+			}
+			return m
+		})
+	}
+	if r.cfg.NIK {
+		s = nikRegexp.ReplaceAllStringFunc(s, func(m string) string {
+			if nikValid(m) {
+				return r.replacement
+			}
+			return m
+		})
+	}
+	if r.cfg.PhoneNumbers {
+		s = phoneRegexpRedact.ReplaceAllString(s, r.replacement)
+	}
+	if r.cfg.Emails {
+		s = emailRegexpRedact.ReplaceAllString(s, r.replacement)
+	}
+	for _, p := range r.patterns {
+		s = p.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+// RedactJSON function for redacting nested json document, invalid json is redacted as free text,
+// documents without personal data are returned unchanged
+func (r *Redactor) RedactJSON(b []byte) []byte {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return []byte(r.RedactString(string(b)))
+	}
+
+	var changed bool
+	v = r.redactDecoded(v, &changed)
+	if !changed {
+		return b
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return []byte(r.RedactString(string(b)))
+	}
+	return out
+}
+
+// RedactValues function for redacting form or query values
+func (r *Redactor) RedactValues(values url.Values) url.Values {
+	result := make(url.Values, len(values))
+	for k, vs := range values {
+		redacted := make([]string, len(vs))
+		for i, v := range vs {
+			if r.IsSensitiveKey(k) {
+				redacted[i] = r.replacement
+			} else {
+				redacted[i] = r.RedactString(v)
+			}
+		}
+		result[k] = redacted
+	}
+	return result
+}
+
+// RedactQuery function for redacting url encoded form body or query string,
+// order and encoding of untouched parameters are kept
+func (r *Redactor) RedactQuery(s string) string {
+	pairs := strings.Split(s, "&")
+	for i, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		key, err := url.QueryUnescape(kv[0])
+		if err != nil {
+			key = kv[0]
+		}
+		if r.IsSensitiveKey(key) {
+			pairs[i] = kv[0] + "=" + r.replacement
+			continue
+		}
+
+		value, err := url.QueryUnescape(kv[1])
+		if err != nil {
+			pairs[i] = kv[0] + "=" + r.RedactString(kv[1])
+			continue
+		}
+		if redacted := r.RedactString(value); redacted != value {
+			pairs[i] = kv[0] + "=" + url.QueryEscape(redacted)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// RedactHeaders function for redacting http headers
+func (r *Redactor) RedactHeaders(h http.Header) http.Header {
+	return http.Header(r.RedactValues(url.Values(h)))
+}
+
+// RedactPayload function for redacting request or response body,
+// json documents are walked, url encoded forms are parsed, anything else is redacted as free text
+func (r *Redactor) RedactPayload(b []byte) []byte {
+	trimmed := bytes.TrimSpace(b)
+	if len(trimmed) == 0 {
+		return b
+	}
+
+	switch trimmed[0] {
+	case '{', '[':
+		return r.RedactJSON(b)
+	}
+
+	s := string(b)
+	if formRegexp.MatchString(s) {
+		return []byte(r.RedactQuery(s))
+	}
+	return []byte(r.RedactString(s))
+}
+
+// RedactValue function for redacting arbitrary value such as log field,
+// maps, slices and structs are walked through their json representation
+// and replaced by the redacted representation only when they hold personal data
+func (r *Redactor) RedactValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case string:
+		return r.RedactString(val)
+	case []byte:
+		return string(r.RedactPayload(val))
+	case error:
+		if val == nil {
+			return v
+		}
+		if redacted := r.RedactString(val.Error()); redacted != val.Error() {
+			return redacted
+		}
+		return v
+	case http.Header:
+		return r.RedactHeaders(val)
+	case url.Values:
+		return r.RedactValues(val)
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var decoded interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&decoded); err != nil {
+		return v
+	}
+
+	var changed bool
+	decoded = r.redactDecoded(decoded, &changed)
+	if !changed {
+		return v
+	}
+	return decoded
+}
+
+// redactDecoded function for walking value decoded from json, changed is set when anything was redacted
+func (r *Redactor) redactDecoded(v interface{}, changed *bool) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			if r.IsSensitiveKey(k) {
+				val[k] = r.replacement
+				*changed = true
+			} else {
+				val[k] = r.redactDecoded(item, changed)
+			}
+		}
+		return val
+	case []interface{}:
+		for i, item := range val {
+			val[i] = r.redactDecoded(item, changed)
+		}
+		return val
+	case string:
+		if redacted := r.RedactString(val); redacted != val {
+			*changed = true
+			return redacted
+		}
+		return val
+	case json.Number:
+		if redacted := r.RedactString(val.String()); redacted != val.String() {
+			*changed = true
+			return redacted
+		}
+		return val
+	}
+	return v
+}
+
+// NewRedactionHook function for creating logrus hook redacting entries with r, nil uses the default redactor
+func NewRedactionHook(r *Redactor) *RedactionHook {
+	return &RedactionHook{Redactor: r}
+}
+
+// Levels function for getting levels handled by the hook
+func (h *RedactionHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire function for redacting message and fields of entry
+func (h *RedactionHook) Fire(entry *log.Entry) error {
+	r := h.Redactor
+	if r == nil {
+		r = DefaultRedactor()
+	}
+
+	entry.Message = r.redactEntry(entry, entry.Message)
+	return nil
+}
+
+// redactEntry function for redacting fields of entry in place and returning redacted message
+func (r *Redactor) redactEntry(entry *log.Entry, message string) string {
+	for k, v := range entry.Data {
+		if r.IsSensitiveKey(k) {
+			entry.Data[k] = r.replacement
+			continue
+		}
+		entry.Data[k] = r.RedactValue(v)
+	}
+	return string(r.RedactPayload([]byte(message)))
+}
+
+// luhnValid function for validating card number checksum
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// nikValid function for validating province code and birth date segments of NIK
+func nikValid(s string) bool {
+	province := atoi2(s[0:2])
+	day := atoi2(s[6:8])
+	month := atoi2(s[8:10])
+
+	// female NIK adds 40 into the day of birth
+	if day > 40 {
+		day -= 40
+	}
+	return province >= 11 && province <= 94 && day >= 1 && day <= 31 && month >= 1 && month <= 12
+}
+
+// atoi2 function for parsing two digits
+func atoi2(s string) int {
+	return int(s[0]-'0')*10 + int(s[1]-'0')
+}
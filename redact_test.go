@@ -0,0 +1,107 @@
+package golib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactString(t *testing.T) {
+	r := NewRedactor(DefaultRedactionConfig())
+
+	t.Run("SUCCESS RedactString", func(t *testing.T) {
+		s := r.RedactString("card 4111 1111 1111 1111 email john.doe@example.com phone +6281234567890 nik 3174015508900001")
+		assert.Equal(t, "card xxxxx email xxxxx phone xxxxx nik xxxxx", s)
+	})
+
+	t.Run("NOT DETECTED RedactString", func(t *testing.T) {
+		// fails luhn checksum and NIK province code
+		s := "order 0000000000000001 amount 1234"
+		assert.Equal(t, s, r.RedactString(s))
+	})
+
+	t.Run("PATTERN RedactString", func(t *testing.T) {
+		custom := NewRedactor(RedactionConfig{Patterns: []*regexp.Regexp{regexp.MustCompile(`INV-\d+`)}, Replacement: "***"})
+		assert.Equal(t, "invoice ***", custom.RedactString("invoice INV-123"))
+	})
+}
+
+func TestRedactPayload(t *testing.T) {
+	r := NewRedactor(DefaultRedactionConfig())
+
+	t.Run("NESTED JSON RedactPayload", func(t *testing.T) {
+		out := r.RedactPayload([]byte(`{"user":{"email":"a@b.co","Password":"secret","cards":[{"card_number":"x"}]},"id":1}`))
+
+		var v map[string]interface{}
+		assert.NoError(t, json.Unmarshal(out, &v))
+		user := v["user"].(map[string]interface{})
+		assert.Equal(t, RedactedValue, user["email"])
+		assert.Equal(t, RedactedValue, user["Password"])
+		assert.Equal(t, RedactedValue, user["cards"].([]interface{})[0].(map[string]interface{})["card_number"])
+		assert.Equal(t, float64(1), v["id"])
+	})
+
+	t.Run("UNCHANGED JSON RedactPayload", func(t *testing.T) {
+		body := []byte(`{"b":1, "a":"<ok>"}`)
+		assert.Equal(t, body, r.RedactPayload(body))
+	})
+
+	t.Run("FORM RedactPayload", func(t *testing.T) {
+		out := r.RedactPayload([]byte("token=abcde&name=john&email=john%40example.com&new_password=x"))
+		assert.Equal(t, "token=xxxxx&name=john&email=xxxxx&new_password=xxxxx", string(out))
+	})
+
+	t.Run("TEXT RedactPayload", func(t *testing.T) {
+		out := r.RedactPayload([]byte("http://example.com/?a=b"))
+		assert.Equal(t, "http://example.com/?a=b", string(out))
+	})
+}
+
+func TestRedactHeaders(t *testing.T) {
+	r := NewRedactor(DefaultRedactionConfig())
+	h := http.Header{}
+	h.Set("Authorization", "Bearer abc")
+	h.Set("X-Api-Key", "abc")
+	h.Set("Content-Type", "application/json")
+
+	t.Run("SUCCESS RedactHeaders", func(t *testing.T) {
+		out := r.RedactHeaders(h)
+		assert.Equal(t, RedactedValue, out.Get("Authorization"))
+		assert.Equal(t, RedactedValue, out.Get("X-Api-Key"))
+		assert.Equal(t, "application/json", out.Get("Content-Type"))
+		assert.Equal(t, "Bearer abc", h.Get("Authorization"))
+	})
+}
+
+func TestRedactionHook(t *testing.T) {
+	defer closeLoggerOutputs()
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf}}}))
+
+	t.Run("SUCCESS RedactionHook", func(t *testing.T) {
+		LogError(errors.New("user john@example.com not found"), "redact", map[string]string{"password": "secret", "phone": "081234567890"})
+		LogCtx(WithLogFields(context.Background(), map[string]interface{}{"token": "abc"}), InfoLevel, "login", "redact", "login")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.NotContains(t, buf.String(), "secret")
+		assert.NotContains(t, buf.String(), "081234567890")
+		assert.NotContains(t, buf.String(), "john@example.com")
+		assert.NotContains(t, buf.String(), `"token":"abc"`)
+	})
+
+	t.Run("DISABLED RedactionHook", func(t *testing.T) {
+		buf.Reset()
+		assert.NoError(t, SetupLogger(LoggerConfig{Outputs: []LogOutputConfig{{Type: LogOutputWriter, Writer: buf}}, DisableRedaction: true}))
+		Log(InfoLevel, "john@example.com", "redact", "raw")
+		assert.NoError(t, FlushLogs(context.Background()))
+
+		assert.Contains(t, buf.String(), "john@example.com")
+	})
+}
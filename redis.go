@@ -2,58 +2,265 @@ package golib
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
 )
 
-// redisClient variable for setting redis client
-var redisClient = map[string]*redis.Client{}
+// RedisMode topology of redis node
+type RedisMode string
 
-// RedisClient function for setting redis client
-func RedisClient(node string) *redis.Client {
+const (
+	// RedisStandalone single redis server, the default mode
+	RedisStandalone RedisMode = "standalone"
+	// RedisSentinel master discovered through sentinels
+	RedisSentinel RedisMode = "sentinel"
+	// RedisCluster redis cluster discovered from seed addresses
+	RedisCluster RedisMode = "cluster"
+)
+
+// RedisConfig configuration of redis node
+type RedisConfig struct {
+	// Mode topology, default RedisStandalone
+	Mode RedisMode `json:"mode"`
+	// Addrs address of the server, addresses of sentinels or seed addresses of the cluster
+	Addrs []string `json:"addrs"`
+	// MasterName name of the master monitored by sentinels
+	MasterName string `json:"masterName"`
+	// DB database selected after connecting, not supported by cluster
+	DB       int    `json:"db"`
+	Password string `json:"password"`
+	// MaxRetries retries of a failed command, zero does not retry
+	MaxRetries int `json:"maxRetries"`
+	// PoolSize connections per server, zero uses ten connections per CPU
+	PoolSize int `json:"poolSize"`
+	// IdleTimeout idle time after which connections are closed, zero uses five minutes
+	IdleTimeout time.Duration `json:"idleTimeout"`
+	// ReadOnly cluster reads are sent to replica nodes
+	ReadOnly bool `json:"readOnly"`
+	// TLS connection uses TLS verified against system roots or TLSCACert
+	TLS bool `json:"tls"`
+	// TLSCACert path of CA bundle verifying server certificate
+	TLSCACert string `json:"tlsCaCert"`
+	// TLSCert path of client certificate for mutual TLS
+	TLSCert string `json:"tlsCert"`
+	// TLSKey path of client certificate key for mutual TLS
+	TLSKey string `json:"tlsKey"`
+	// TLSServerName name verified against server certificate instead of the host of the address
+	TLSServerName string `json:"tlsServerName"`
+	// TLSMinVersion minimum version such as "1.2" or "1.3", default "1.2"
+	TLSMinVersion string `json:"tlsMinVersion"`
+	// TLSInsecureSkipVerify server certificate is not verified, for development only
+	TLSInsecureSkipVerify bool `json:"tlsInsecureSkipVerify"`
+}
+
+// redisTLSVersions versions accepted by TLSMinVersion
+var redisTLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// RedisConfigFromEnv function for reading redis configuration of node from environment variables
+// REDIS_<node>_MODE, REDIS_<node>_HOST, REDIS_<node>_ADDRS (comma separated sentinel or cluster addresses),
+// REDIS_<node>_MASTER_NAME, REDIS_<node>_DB, REDIS_<node>_PASS, REDIS_<node>_MAX_RETRIES, REDIS_<node>_POOL_SIZE,
+// REDIS_<node>_IDLE_TIMEOUT (seconds), REDIS_<node>_READ_ONLY, REDIS_<node>_TLS, REDIS_<node>_TLS_CA,
+// REDIS_<node>_TLS_CERT, REDIS_<node>_TLS_KEY, REDIS_<node>_TLS_SERVER_NAME, REDIS_<node>_TLS_MIN_VERSION
+// and REDIS_<node>_TLS_SKIP_VERIFY
+// node string such as "CACHE"
+func RedisConfigFromEnv(node string) (RedisConfig, error) {
+	env := func(k string) string {
+		return os.Getenv(fmt.Sprintf("REDIS_%s_%s", node, k))
+	}
 
-	if val, ok := redisClient[node]; ok {
-		return val
+	cfg := RedisConfig{
+		Mode:          RedisMode(env("MODE")),
+		MasterName:    env("MASTER_NAME"),
+		Password:      env("PASS"),
+		TLSCACert:     env("TLS_CA"),
+		TLSCert:       env("TLS_CERT"),
+		TLSKey:        env("TLS_KEY"),
+		TLSServerName: env("TLS_SERVER_NAME"),
+		TLSMinVersion: env("TLS_MIN_VERSION"),
+	}
+	for _, addr := range strings.Split(env("ADDRS"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			cfg.Addrs = append(cfg.Addrs, addr)
+		}
+	}
+	if len(cfg.Addrs) == 0 && env("HOST") != "" {
+		cfg.Addrs = []string{env("HOST")}
 	}
 
-	// get the real credentials from master connections
-	host := os.Getenv(fmt.Sprintf("REDIS_%s_HOST", node))
-	db, _ := strconv.Atoi(os.Getenv(fmt.Sprintf("REDIS_%s_DB", node)))
-	password := os.Getenv(fmt.Sprintf("REDIS_%s_PASS", node))
-	maxRetries, _ := strconv.Atoi(os.Getenv(fmt.Sprintf("REDIS_%s_MAX_RETRIES", node)))
-	timeout, _ := strconv.Atoi(os.Getenv(fmt.Sprintf("REDIS_%s_IDLE_TIMEOUT", node)))
-	idleTimeout := time.Duration(timeout)
-	tlsSecured, _ := strconv.ParseBool(os.Getenv(fmt.Sprintf("REDIS_%s_TLS", node)))
+	var err error
+	for k, v := range map[string]*int{"DB": &cfg.DB, "MAX_RETRIES": &cfg.MaxRetries, "POOL_SIZE": &cfg.PoolSize} {
+		if s := env(k); s != "" {
+			if *v, err = strconv.Atoi(s); err != nil {
+				return cfg, fmt.Errorf("invalid REDIS_%s_%s: %v", node, k, err)
+			}
+		}
+	}
+	if s := env("IDLE_TIMEOUT"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid REDIS_%s_IDLE_TIMEOUT: %v", node, err)
+		}
+		cfg.IdleTimeout = time.Duration(seconds) * time.Second
+	}
+	for k, v := range map[string]*bool{"READ_ONLY": &cfg.ReadOnly, "TLS": &cfg.TLS, "TLS_SKIP_VERIFY": &cfg.TLSInsecureSkipVerify} {
+		if s := env(k); s != "" {
+			if *v, err = strconv.ParseBool(s); err != nil {
+				return cfg, fmt.Errorf("invalid REDIS_%s_%s: %v", node, k, err)
+			}
+		}
+	}
+	return cfg, nil
+}
 
-	var conf *tls.Config
+// Validate function for checking mode, the fields it requires and TLS options
+func (c RedisConfig) Validate() error {
+	if !c.TLS && (c.TLSCACert != "" || c.TLSCert != "" || c.TLSKey != "" || c.TLSServerName != "" || c.TLSMinVersion != "" || c.TLSInsecureSkipVerify) {
+		return errors.New("invalid redis config: tls options require tls")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("invalid redis config: tls cert and tls key must be set together")
+	}
+	if _, ok := redisTLSVersions[c.TLSMinVersion]; c.TLSMinVersion != "" && !ok {
+		return fmt.Errorf("invalid redis config: unsupported tls min version %q", c.TLSMinVersion)
+	}
 
-	if tlsSecured {
-		conf = &tls.Config{
-			InsecureSkipVerify: tlsSecured,
+	switch c.Mode {
+	case "", RedisStandalone:
+		if len(c.Addrs) > 1 {
+			return errors.New("invalid redis config: standalone mode accepts a single address")
+		}
+	case RedisSentinel:
+		if c.MasterName == "" {
+			return errors.New("invalid redis config: sentinel mode requires master name")
+		}
+		if len(c.Addrs) == 0 {
+			return errors.New("invalid redis config: sentinel mode requires sentinel addresses")
+		}
+	case RedisCluster:
+		if len(c.Addrs) == 0 {
+			return errors.New("invalid redis config: cluster mode requires seed addresses")
+		}
+		if c.DB != 0 {
+			return errors.New("invalid redis config: cluster mode supports database 0 only")
 		}
+	default:
+		return fmt.Errorf("invalid redis config: unsupported mode %q", c.Mode)
 	}
+	return nil
+}
 
-	client := redis.NewClient(&redis.Options{
-		Addr:        host,
-		Password:    password,
-		DB:          db,
-		MaxRetries:  maxRetries,
-		IdleTimeout: time.Second * idleTimeout,
-		TLSConfig:   conf,
-	})
+// tlsConfig function for building TLS configuration, nil when TLS is disabled,
+// certificate files which cannot be read or parsed are reported as error
+func (c RedisConfig) tlsConfig() (*tls.Config, error) {
+	if !c.TLS {
+		return nil, nil
+	}
+
+	conf := &tls.Config{
+		ServerName:         c.TLSServerName,
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+	if c.TLSMinVersion != "" {
+		conf.MinVersion = redisTLSVersions[c.TLSMinVersion]
+	}
 
-	redisClient[node] = client
+	if c.TLSCACert != "" {
+		pem, err := ioutil.ReadFile(c.TLSCACert)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis tls ca: %v", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("invalid redis tls ca: no certificate found in %s", c.TLSCACert)
+		}
+	}
+
+	if c.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis tls cert: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// NewRedisClient function for creating client of the configured topology,
+// the returned client is *redis.Client for standalone and sentinel and *redis.ClusterClient for cluster
+// cfg RedisConfig
+func NewRedisClient(cfg RedisConfig) (redis.UniversalClient, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	conf, err := cfg.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Mode {
+	case RedisSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: cfg.Addrs,
+			Password:      cfg.Password,
+			DB:            cfg.DB,
+			MaxRetries:    cfg.MaxRetries,
+			PoolSize:      cfg.PoolSize,
+			IdleTimeout:   cfg.IdleTimeout,
+			TLSConfig:     conf,
+		}), nil
+	case RedisCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:       cfg.Addrs,
+			Password:    cfg.Password,
+			ReadOnly:    cfg.ReadOnly,
+			MaxRetries:  cfg.MaxRetries,
+			PoolSize:    cfg.PoolSize,
+			IdleTimeout: cfg.IdleTimeout,
+			TLSConfig:   conf,
+		}), nil
+	}
+
+	var addr string
+	if len(cfg.Addrs) > 0 {
+		addr = cfg.Addrs[0]
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:        addr,
+		Password:    cfg.Password,
+		DB:          cfg.DB,
+		MaxRetries:  cfg.MaxRetries,
+		PoolSize:    cfg.PoolSize,
+		IdleTimeout: cfg.IdleTimeout,
+		TLSConfig:   conf,
+	}), nil
+}
 
-	return client
+// RedisClient function for getting redis client of node from DefaultRedisRegistry, the client is created
+// without ping and connects on its first command, configuration errors are logged once and returned by every command
+// of the returned client until CloseRedisNode, use GetRedis to ping the node and handle the error
+func RedisClient(node string) redis.UniversalClient {
+	return DefaultRedisRegistry.lazyClient(node)
 }
 
-// CloseRedis function for closing redis connection
+// CloseRedis function for closing and removing every redis connection of DefaultRedisRegistry
 func CloseRedis() {
-	for _, c := range redisClient {
-		c.Close()
+	if err := DefaultRedisRegistry.CloseAll(); err != nil {
+		LogError(err, "redis", "close")
 	}
 }
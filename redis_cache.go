@@ -0,0 +1,475 @@
+package golib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// cacheValue marker of cached value
+	cacheValue byte = 'v'
+	// cacheNotFound marker of cached not found result
+	cacheNotFound byte = 'n'
+	// gzipRaw marker of value stored without compression by GzipCodec
+	gzipRaw byte = 'r'
+	// gzipCompressed marker of value compressed by GzipCodec
+	gzipCompressed byte = 'z'
+
+	// cacheTagPrefix prefix of sets holding keys of a tag
+	cacheTagPrefix = "golib:cache:tag:"
+)
+
+// DefaultCacheLoadTimeout timeout of loader calls shared by concurrent misses when CacheOptions.LoadTimeout is zero
+const DefaultCacheLoadTimeout = 30 * time.Second
+
+// ErrCacheNotFound error returned by loader when the value does not exist, the result is cached for CacheOptions.NegativeTTL
+var ErrCacheNotFound = errors.New("cache: not found")
+
+// cacheTagScript script adding key into tag set and extending expiration of the set to the longest ttl of its keys,
+// ttl zero is a key without expiration so the set is persisted and never expires again
+var cacheTagScript = redis.NewScript(`
+local exists = redis.call("EXISTS", KEYS[1])
+redis.call("SADD", KEYS[1], ARGV[1])
+local ttl = tonumber(ARGV[2])
+if ttl == 0 then
+	redis.call("PERSIST", KEYS[1])
+	return 1
+end
+local current = redis.call("TTL", KEYS[1])
+if exists == 0 or (current >= 0 and current < ttl) then
+	redis.call("EXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
+var (
+	cacheGroupsMu sync.Mutex
+	cacheGroups   = map[string]*cacheGroup{}
+)
+
+// CacheCodec encoding of cached values
+type CacheCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec codec encoding values as json, the default codec
+type JSONCodec struct{}
+
+// Marshal function for encoding v as json
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal function for decoding json into v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// GobCodec codec encoding values with encoding/gob
+type GobCodec struct{}
+
+// Marshal function for encoding v with gob
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal function for decoding gob into v
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// GzipCodec codec compressing values encoded by Codec
+type GzipCodec struct {
+	// Codec encoding values before compression, default JSONCodec
+	Codec CacheCodec
+	// MinSize values smaller than MinSize bytes are stored uncompressed
+	MinSize int
+}
+
+// codec function for getting wrapped codec
+func (c GzipCodec) codec() CacheCodec {
+	if c.Codec == nil {
+		return JSONCodec{}
+	}
+	return c.Codec
+}
+
+// Marshal function for encoding and compressing v
+func (c GzipCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.codec().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < c.MinSize {
+		return append([]byte{gzipRaw}, data...), nil
+	}
+
+	b := bytes.NewBuffer([]byte{gzipCompressed})
+	w := gzip.NewWriter(b)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal function for decompressing and decoding data into v
+func (c GzipCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) == 0 {
+		return errors.New("cache: empty gzip value")
+	}
+	if data[0] == gzipRaw {
+		return c.codec().Unmarshal(data[1:], v)
+	}
+	if data[0] != gzipCompressed {
+		return errors.New("cache: unknown gzip value")
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return c.codec().Unmarshal(raw, v)
+}
+
+// CacheOptions options of RedisCache
+type CacheOptions struct {
+	// Codec encoding of values, default JSONCodec
+	Codec CacheCodec
+	// NegativeTTL expiration of cached ErrCacheNotFound results, zero does not cache them
+	NegativeTTL time.Duration
+	// Jitter fraction of ttl randomly removed from every expiration, such as 0.1 for up to ten percent
+	Jitter float64
+	// Tags tags of remembered keys, invalidated together by InvalidateTags
+	Tags []string
+	// LoadTimeout timeout of the loader call shared by concurrent misses, default DefaultCacheLoadTimeout
+	LoadTimeout time.Duration
+}
+
+// RedisCache cache-aside on redis, concurrent misses of a key share a single loader call
+type RedisCache struct {
+	client redis.UniversalClient
+	opts   CacheOptions
+	group  *cacheGroup
+}
+
+// NewRedisCache function for creating cache of client
+// client redis.UniversalClient
+// opts CacheOptions
+func NewRedisCache(client redis.UniversalClient, opts CacheOptions) *RedisCache {
+	return &RedisCache{client: client, opts: opts, group: &cacheGroup{}}
+}
+
+// Remember function for getting value of key into out, a miss calls loader and caches its result for ttl,
+// ErrCacheNotFound of loader is cached for NegativeTTL and returned, redis errors are logged and loader is called,
+// concurrent misses with the same codec share one loader call and wait for it until their own ctx ends,
+// the loader is called with a context keeping values of the first caller but not its cancellation, ended by LoadTimeout
+// ctx context.Context
+// key string
+// ttl time.Duration
+// loader func(ctx context.Context) (interface{}, error)
+// out interface{} pointer decoded by the codec
+func (c *RedisCache) Remember(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error), out interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	codec := c.codec()
+
+	b, err := c.client.Get(key).Bytes()
+	switch {
+	case err == nil:
+		data, err := decodeCacheEntry(b)
+		if err == ErrCacheNotFound {
+			return err
+		}
+		if err == nil {
+			if err = codec.Unmarshal(data, out); err == nil {
+				return nil
+			}
+		}
+		LogCtx(ctx, WarnLevel, fmt.Sprintf("cache entry %s is unreadable, reloading: %v", key, err), "cache", "remember")
+	case err != redis.Nil:
+		LogCtx(ctx, WarnLevel, fmt.Sprintf("cache unavailable for %s: %v", key, err), "cache", "remember")
+	}
+
+	loadCtx := detachedContext{parent: ctx}
+	data, err := c.group.do(ctx, cacheCallKey{codec: fmt.Sprintf("%#v", codec), key: key}, func() ([]byte, error) {
+		ctx, cancel := context.WithTimeout(loadCtx, c.loadTimeout())
+		defer cancel()
+		return c.load(ctx, key, ttl, loader)
+	})
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data, out)
+}
+
+// load function for calling loader and caching its result
+func (c *RedisCache) load(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error)) ([]byte, error) {
+	v, err := loader(ctx)
+	if err == ErrCacheNotFound {
+		if c.opts.NegativeTTL > 0 {
+			c.store(ctx, key, []byte{cacheNotFound}, c.jitter(c.opts.NegativeTTL))
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.codec().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	c.store(ctx, key, append([]byte{cacheValue}, data...), c.jitter(ttl))
+	return data, nil
+}
+
+// store function for writing entry and adding key into its tags, errors are logged
+func (c *RedisCache) store(ctx context.Context, key string, entry []byte, ttl time.Duration) {
+	if err := c.client.Set(key, entry, ttl).Err(); err != nil {
+		LogCtx(ctx, WarnLevel, fmt.Sprintf("cache write of %s failed: %v", key, err), "cache", "remember")
+		return
+	}
+
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	for _, tag := range c.opts.Tags {
+		if err := cacheTagScript.Run(c.client, []string{cacheTagPrefix + tag}, key, seconds).Err(); err != nil {
+			LogCtx(ctx, WarnLevel, fmt.Sprintf("cache tag %s of %s failed: %v", tag, key, err), "cache", "remember")
+		}
+	}
+}
+
+// Invalidate function for removing keys
+// keys ...string
+func (c *RedisCache) Invalidate(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	// keys are deleted one by one so cluster clients route them to their own slots
+	pipe := c.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(key)
+	}
+	_, err := pipe.Exec()
+	return err
+}
+
+// InvalidateTags function for removing every key remembered with the tags
+// tags ...string
+func (c *RedisCache) InvalidateTags(tags ...string) error {
+	for _, tag := range tags {
+		keys, err := c.client.SMembers(cacheTagPrefix + tag).Result()
+		if err != nil {
+			return err
+		}
+		if err := c.Invalidate(append(keys, cacheTagPrefix+tag)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// codec function for getting codec of cache
+func (c *RedisCache) codec() CacheCodec {
+	if c.opts.Codec == nil {
+		return JSONCodec{}
+	}
+	return c.opts.Codec
+}
+
+// loadTimeout function for getting timeout of shared loader calls
+func (c *RedisCache) loadTimeout() time.Duration {
+	if c.opts.LoadTimeout <= 0 {
+		return DefaultCacheLoadTimeout
+	}
+	return c.opts.LoadTimeout
+}
+
+// jitter function for shortening ttl by a random fraction up to Jitter
+func (c *RedisCache) jitter(ttl time.Duration) time.Duration {
+	if c.opts.Jitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	j := c.opts.Jitter
+	if j > 1 {
+		j = 1
+	}
+	return ttl - time.Duration(rand.Float64()*j*float64(ttl))
+}
+
+// decodeCacheEntry function for getting value of entry, ErrCacheNotFound for cached not found result
+func decodeCacheEntry(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errors.New("cache: empty entry")
+	}
+	switch b[0] {
+	case cacheValue:
+		return b[1:], nil
+	case cacheNotFound:
+		return nil, ErrCacheNotFound
+	}
+	return nil, errors.New("cache: unknown entry")
+}
+
+// detachedContext context keeping values of parent without its deadline and cancellation
+type detachedContext struct {
+	parent context.Context
+}
+
+// Deadline function for getting deadline, a detached context has none
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+// Done function for getting done channel, a detached context is never done
+func (detachedContext) Done() <-chan struct{} { return nil }
+
+// Err function for getting error, a detached context is never cancelled
+func (detachedContext) Err() error { return nil }
+
+// Value function for getting value of key from parent
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+// cacheCallKey key of loader call in flight, calls of different codecs are never shared
+type cacheCallKey struct {
+	codec string
+	key   string
+}
+
+// cacheGroup calls of loaders in flight by codec and key
+type cacheGroup struct {
+	mu    sync.Mutex
+	calls map[cacheCallKey]*cacheCall
+}
+
+// cacheCall loader call in flight, done is closed once data and err are set
+type cacheCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// do function for calling fn once in background for concurrent callers of key, every caller gets its result,
+// a caller returns the error of its ctx when ctx ends before the call while the call goes on for the others
+func (g *cacheGroup) do(ctx context.Context, key cacheCallKey, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[cacheCallKey]*cacheCall{}
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &cacheCall{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.call(key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.data, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// call function for running fn of call and releasing its callers, a panic of fn is returned as error
+func (g *cacheGroup) call(key cacheCallKey, c *cacheCall, fn func() ([]byte, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.data, c.err = nil, fmt.Errorf("cache: loader of %s panicked: %v", key.key, r)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.data, c.err = fn()
+}
+
+// nodeCacheGroup function for getting loader calls in flight of redis node
+func nodeCacheGroup(node string) *cacheGroup {
+	cacheGroupsMu.Lock()
+	defer cacheGroupsMu.Unlock()
+
+	g, ok := cacheGroups[node]
+	if !ok {
+		g = &cacheGroup{}
+		cacheGroups[node] = g
+	}
+	return g
+}
+
+// nodeCache function for getting cache of redis node of DefaultRedisRegistry
+func nodeCache(node string, opts []CacheOptions) (*RedisCache, error) {
+	client, err := GetRedis(node)
+	if err != nil {
+		return nil, err
+	}
+
+	var o CacheOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	return &RedisCache{client: client, opts: o, group: nodeCacheGroup(node)}, nil
+}
+
+// Remember function for getting value of key cached on redis node into out, a miss calls loader, see RedisCache.Remember
+// ctx context.Context
+// node string redis node of DefaultRedisRegistry
+// key string
+// ttl time.Duration
+// loader func(ctx context.Context) (interface{}, error)
+// out interface{} pointer decoded by the codec
+// opts ...CacheOptions
+func Remember(ctx context.Context, node, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error), out interface{}, opts ...CacheOptions) error {
+	cache, err := nodeCache(node, opts)
+	if err != nil {
+		return err
+	}
+	return cache.Remember(ctx, key, ttl, loader, out)
+}
+
+// InvalidateCache function for removing keys cached on redis node
+// node string redis node of DefaultRedisRegistry
+// keys ...string
+func InvalidateCache(node string, keys ...string) error {
+	cache, err := nodeCache(node, nil)
+	if err != nil {
+		return err
+	}
+	return cache.Invalidate(keys...)
+}
+
+// InvalidateCacheTags function for removing every key cached on redis node with the tags
+// node string redis node of DefaultRedisRegistry
+// tags ...string
+func InvalidateCacheTags(node string, tags ...string) error {
+	cache, err := nodeCache(node, nil)
+	if err != nil {
+		return err
+	}
+	return cache.InvalidateTags(tags...)
+}
@@ -0,0 +1,321 @@
+package golib
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type cachedOrder struct {
+	ID   int
+	Code string
+}
+
+func TestRedisCacheRemember(t *testing.T) {
+	s, client := newTestRedis(t)
+	defer s.Close()
+	ctx := context.Background()
+
+	t.Run("MISS & HIT Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{})
+		var calls int32
+		loader := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return cachedOrder{ID: 1, Code: "ORD-1"}, nil
+		}
+
+		for i := 0; i < 2; i++ {
+			var order cachedOrder
+			assert.NoError(t, cache.Remember(ctx, "order:1", time.Minute, loader, &order))
+			assert.Equal(t, cachedOrder{ID: 1, Code: "ORD-1"}, order)
+		}
+		assert.Equal(t, int32(1), calls)
+		assert.Equal(t, time.Minute, s.TTL("order:1"))
+	})
+
+	t.Run("CONCURRENT Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{})
+		var calls int32
+		loader := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(50 * time.Millisecond)
+			return cachedOrder{ID: 2}, nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var order cachedOrder
+				assert.NoError(t, cache.Remember(ctx, "order:2", time.Minute, loader, &order))
+				assert.Equal(t, 2, order.ID)
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("CANCELLED WAITER Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{})
+		started := make(chan struct{})
+		release := make(chan struct{})
+		leader := make(chan error, 1)
+		go func() {
+			leader <- cache.Remember(ctx, "order:slow", time.Minute, func(ctx context.Context) (interface{}, error) {
+				close(started)
+				<-release
+				return cachedOrder{ID: 5}, nil
+			}, &cachedOrder{})
+		}()
+		<-started
+
+		waiterCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		err := cache.Remember(waiterCtx, "order:slow", time.Minute, func(ctx context.Context) (interface{}, error) {
+			t.Error("loader called twice")
+			return nil, nil
+		}, &cachedOrder{})
+		assert.Equal(t, context.DeadlineExceeded, err)
+
+		close(release)
+		assert.NoError(t, <-leader)
+	})
+
+	t.Run("CANCELLED FIRST CALLER Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{})
+		started := make(chan struct{})
+		release := make(chan struct{})
+		firstCtx, cancel := context.WithCancel(ctx)
+		first := make(chan error, 1)
+		go func() {
+			first <- cache.Remember(firstCtx, "order:shared", time.Minute, func(ctx context.Context) (interface{}, error) {
+				close(started)
+				<-release
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				return cachedOrder{ID: 6}, nil
+			}, &cachedOrder{})
+		}()
+		<-started
+
+		cancel()
+		assert.Equal(t, context.Canceled, <-first)
+
+		time.AfterFunc(20*time.Millisecond, func() { close(release) })
+		var order cachedOrder
+		assert.NoError(t, cache.Remember(ctx, "order:shared", time.Minute, func(ctx context.Context) (interface{}, error) {
+			t.Error("loader called twice")
+			return nil, nil
+		}, &order))
+		assert.Equal(t, 6, order.ID)
+	})
+
+	t.Run("LOAD TIMEOUT Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{LoadTimeout: 20 * time.Millisecond})
+		err := cache.Remember(ctx, "order:timeout", time.Minute, func(ctx context.Context) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}, &cachedOrder{})
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("CODECS Remember", func(t *testing.T) {
+		group := &cacheGroup{}
+		jsonCache := &RedisCache{client: client, opts: CacheOptions{}, group: group}
+		gobCache := &RedisCache{client: client, opts: CacheOptions{Codec: GobCodec{}}, group: group}
+		var calls int32
+		release := make(chan struct{})
+		loader := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return cachedOrder{ID: 7}, nil
+		}
+
+		var wg sync.WaitGroup
+		for _, cache := range []*RedisCache{jsonCache, gobCache} {
+			wg.Add(1)
+			go func(cache *RedisCache) {
+				defer wg.Done()
+				var order cachedOrder
+				assert.NoError(t, cache.Remember(ctx, "order:codec", time.Minute, loader, &order))
+				assert.Equal(t, 7, order.ID)
+			}(cache)
+		}
+		deadline := time.Now().Add(time.Second)
+		for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+		wg.Wait()
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("NEGATIVE Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{NegativeTTL: 10 * time.Second})
+		var calls int32
+		loader := func(ctx context.Context) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, ErrCacheNotFound
+		}
+
+		var order cachedOrder
+		assert.Equal(t, ErrCacheNotFound, cache.Remember(ctx, "order:404", time.Minute, loader, &order))
+		assert.Equal(t, ErrCacheNotFound, cache.Remember(ctx, "order:404", time.Minute, loader, &order))
+		assert.Equal(t, int32(1), calls)
+		assert.Equal(t, 10*time.Second, s.TTL("order:404"))
+	})
+
+	t.Run("ERROR Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{})
+		err := cache.Remember(ctx, "order:err", time.Minute, func(ctx context.Context) (interface{}, error) {
+			return nil, errors.New("database down")
+		}, &cachedOrder{})
+		assert.EqualError(t, err, "database down")
+		assert.False(t, s.Exists("order:err"))
+	})
+
+	t.Run("JITTER Remember", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{Jitter: 0.5})
+		for i := 0; i < 10; i++ {
+			key := "order:jitter:" + string(rune('a'+i))
+			assert.NoError(t, cache.Remember(ctx, key, 100*time.Second, func(ctx context.Context) (interface{}, error) {
+				return cachedOrder{}, nil
+			}, &cachedOrder{}))
+			ttl := s.TTL(key)
+			assert.True(t, ttl >= 50*time.Second && ttl <= 100*time.Second, "ttl %s", ttl)
+		}
+	})
+
+	t.Run("CORRUPTED Remember", func(t *testing.T) {
+		s.Set("order:3", "garbage")
+		cache := NewRedisCache(client, CacheOptions{})
+		var order cachedOrder
+		assert.NoError(t, cache.Remember(ctx, "order:3", time.Minute, func(ctx context.Context) (interface{}, error) {
+			return cachedOrder{ID: 3}, nil
+		}, &order))
+		assert.Equal(t, 3, order.ID)
+	})
+
+	t.Run("UNAVAILABLE Remember", func(t *testing.T) {
+		cache := NewRedisCache(redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"}), CacheOptions{})
+		var order cachedOrder
+		assert.NoError(t, cache.Remember(ctx, "order:4", time.Minute, func(ctx context.Context) (interface{}, error) {
+			return cachedOrder{ID: 4}, nil
+		}, &order))
+		assert.Equal(t, 4, order.ID)
+	})
+}
+
+func TestCacheCodec(t *testing.T) {
+	order := cachedOrder{ID: 1, Code: strings.Repeat("x", 1000)}
+
+	for name, codec := range map[string]CacheCodec{
+		"JSON":       JSONCodec{},
+		"GOB":        GobCodec{},
+		"GZIP":       GzipCodec{},
+		"GZIP GOB":   GzipCodec{Codec: GobCodec{}},
+		"GZIP SMALL": GzipCodec{MinSize: 1 << 20},
+	} {
+		t.Run(name+" CacheCodec", func(t *testing.T) {
+			data, err := codec.Marshal(order)
+			assert.NoError(t, err)
+
+			var out cachedOrder
+			assert.NoError(t, codec.Unmarshal(data, &out))
+			assert.Equal(t, order, out)
+		})
+	}
+
+	t.Run("COMPRESSED GzipCodec", func(t *testing.T) {
+		data, _ := GzipCodec{}.Marshal(order)
+		assert.Equal(t, gzipCompressed, data[0])
+		assert.True(t, len(data) < 100)
+		assert.Error(t, GzipCodec{}.Unmarshal([]byte("?"), &cachedOrder{}))
+	})
+}
+
+func TestRedisCacheInvalidate(t *testing.T) {
+	s, client := newTestRedis(t)
+	defer s.Close()
+	ctx := context.Background()
+	loader := func(ctx context.Context) (interface{}, error) {
+		return cachedOrder{ID: 1}, nil
+	}
+
+	t.Run("SUCCESS Invalidate", func(t *testing.T) {
+		cache := NewRedisCache(client, CacheOptions{})
+		assert.NoError(t, cache.Remember(ctx, "order:1", time.Minute, loader, &cachedOrder{}))
+		assert.NoError(t, cache.Invalidate("order:1"))
+		assert.False(t, s.Exists("order:1"))
+		assert.NoError(t, cache.Invalidate())
+	})
+
+	t.Run("SUCCESS InvalidateTags", func(t *testing.T) {
+		tagged := NewRedisCache(client, CacheOptions{Tags: []string{"orders", "customer:9"}})
+		assert.NoError(t, tagged.Remember(ctx, "order:1", time.Minute, loader, &cachedOrder{}))
+		assert.NoError(t, tagged.Remember(ctx, "order:2", time.Hour, loader, &cachedOrder{}))
+		assert.NoError(t, NewRedisCache(client, CacheOptions{}).Remember(ctx, "order:3", time.Minute, loader, &cachedOrder{}))
+		assert.Equal(t, time.Hour, s.TTL(cacheTagPrefix+"orders"))
+
+		assert.NoError(t, tagged.InvalidateTags("orders"))
+		assert.False(t, s.Exists("order:1"))
+		assert.False(t, s.Exists("order:2"))
+		assert.True(t, s.Exists("order:3"))
+		assert.False(t, s.Exists(cacheTagPrefix+"orders"))
+	})
+
+	t.Run("NO EXPIRATION InvalidateTags", func(t *testing.T) {
+		tagged := NewRedisCache(client, CacheOptions{Tags: []string{"catalog"}})
+		assert.NoError(t, tagged.Remember(ctx, "product:1", 0, loader, &cachedOrder{}))
+		assert.True(t, s.Exists(cacheTagPrefix+"catalog"))
+		assert.Equal(t, time.Duration(0), s.TTL(cacheTagPrefix+"catalog"))
+
+		assert.NoError(t, tagged.Remember(ctx, "product:2", time.Minute, loader, &cachedOrder{}))
+		assert.Equal(t, time.Duration(0), s.TTL(cacheTagPrefix+"catalog"))
+
+		assert.NoError(t, tagged.InvalidateTags("catalog"))
+		assert.False(t, s.Exists("product:1"))
+		assert.False(t, s.Exists("product:2"))
+	})
+}
+
+func TestRemember(t *testing.T) {
+	s, client := newTestRedis(t)
+	defer s.Close()
+	RegisterRedis("cache", client)
+	defer CloseRedisNode("cache")
+	ctx := context.Background()
+
+	t.Run("SUCCESS Remember", func(t *testing.T) {
+		var order cachedOrder
+		err := Remember(ctx, "cache", "order:1", time.Minute, func(ctx context.Context) (interface{}, error) {
+			return cachedOrder{ID: 1}, nil
+		}, &order, CacheOptions{Codec: GobCodec{}, Tags: []string{"orders"}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, order.ID)
+
+		assert.NoError(t, InvalidateCacheTags("cache", "orders"))
+		assert.False(t, s.Exists("order:1"))
+		assert.NoError(t, InvalidateCache("cache", "order:1"))
+	})
+
+	t.Run("ERROR Remember", func(t *testing.T) {
+		os.Setenv("REDIS_cache_down_HOST", "127.0.0.1:1")
+		defer os.Unsetenv("REDIS_cache_down_HOST")
+
+		err := Remember(ctx, "cache_down", "order:1", time.Minute, func(ctx context.Context) (interface{}, error) {
+			return cachedOrder{ID: 1}, nil
+		}, &cachedOrder{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,282 @@
+package golib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// lockPrefix prefix of redis keys holding locks
+	lockPrefix = "golib:lock:"
+	// MinLockTTL shortest ttl of a lock, automatic extension needs a third of it to reach redis
+	MinLockTTL = 100 * time.Millisecond
+)
+
+var (
+	// ErrLockNotAcquired lock is held by another owner
+	ErrLockNotAcquired = errors.New("lock: not acquired")
+	// ErrLockLost lock expired or was taken by another owner while held
+	ErrLockLost = errors.New("lock: lost")
+	// ErrLockExtensionStopped automatic extension stopped before Release because ctx of Acquire ended, the lock will expire
+	ErrLockExtensionStopped = errors.New("lock: extension stopped")
+
+	// lockReleaseScript script deleting lock only when it holds the token
+	lockReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+	// lockExtendScript script extending lock only when it holds the token
+	lockExtendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+)
+
+// LockOptions options of Acquire
+type LockOptions struct {
+	// WaitTimeout acquire retries until the lock is free or WaitTimeout passes, zero tries once
+	WaitTimeout time.Duration
+	// RetryInterval wait between attempts, default 100ms with up to half of it added as jitter
+	RetryInterval time.Duration
+	// AutoExtend lock is extended every third of its ttl until it is released, lost or ctx of Acquire ends
+	AutoExtend bool
+}
+
+// Locker distributed locks on redis
+type Locker struct {
+	client redis.UniversalClient
+}
+
+// Lock lock held by a unique token
+type Lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	err      error
+	lost     chan struct{}
+	lostOnce sync.Once
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// NewLocker function for creating locker of client
+// client redis.UniversalClient
+func NewLocker(client redis.UniversalClient) *Locker {
+	return &Locker{client: client}
+}
+
+// Acquire function for taking lock of key for ttl, ErrLockNotAcquired is returned when another owner
+// holds it after opts.WaitTimeout, the error of ctx is returned when ctx ends first
+// ctx context.Context
+// key string
+// ttl time.Duration at least MinLockTTL
+// opts ...LockOptions
+func (l *Locker) Acquire(ctx context.Context, key string, ttl time.Duration, opts ...LockOptions) (*Lock, error) {
+	if ttl < MinLockTTL {
+		return nil, fmt.Errorf("lock: ttl must be at least %s", MinLockTTL)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var o LockOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = 100 * time.Millisecond
+	}
+
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(o.WaitTimeout)
+	for {
+		ok, err := l.client.SetNX(lockPrefix+key, token, ttl).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			lk := &Lock{client: l.client, key: key, token: token, ttl: ttl, lost: make(chan struct{})}
+			if o.AutoExtend {
+				lk.startExtending(ctx)
+			}
+			return lk, nil
+		}
+
+		wait := o.RetryInterval + time.Duration(mrand.Int63n(int64(o.RetryInterval/2)+1))
+		if o.WaitTimeout <= 0 || time.Now().Add(wait).After(deadline) {
+			return nil, ErrLockNotAcquired
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// lockToken function for generating random token of lock owner
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Key function for getting key of lock
+func (lk *Lock) Key() string {
+	return lk.key
+}
+
+// Token function for getting token of lock owner
+func (lk *Lock) Token() string {
+	return lk.token
+}
+
+// Lost function for getting channel closed when automatic extension finds the lock lost or stops before Release
+func (lk *Lock) Lost() <-chan struct{} {
+	return lk.lost
+}
+
+// Err function for getting ErrLockLost once the lock is lost, ErrLockExtensionStopped once automatic extension stopped before Release
+func (lk *Lock) Err() error {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	return lk.err
+}
+
+// Extend function for resetting expiration of lock to ttl, ErrLockLost is returned when the lock is no longer held
+// ttl time.Duration at least MinLockTTL
+func (lk *Lock) Extend(ttl time.Duration) error {
+	if ttl < MinLockTTL {
+		return fmt.Errorf("lock: ttl must be at least %s", MinLockTTL)
+	}
+	n, err := lockExtendScript.Run(lk.client, []string{lockPrefix + lk.key}, lk.token, int64(ttl/time.Millisecond)).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		lk.setLost(ErrLockLost)
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release function for stopping automatic extension and deleting lock,
+// ErrLockLost is returned when the lock expired or another owner holds it
+func (lk *Lock) Release() error {
+	lk.stopExtending()
+
+	n, err := lockReleaseScript.Run(lk.client, []string{lockPrefix + lk.key}, lk.token).Int64()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		lk.setLost(ErrLockLost)
+		return ErrLockLost
+	}
+	return nil
+}
+
+// setLost function for marking lock lost with err
+func (lk *Lock) setLost(err error) {
+	lk.lostOnce.Do(func() {
+		lk.mu.Lock()
+		lk.err = err
+		lk.mu.Unlock()
+		close(lk.lost)
+	})
+}
+
+// startExtending function for extending lock every third of its ttl in background until it is released,
+// the lock is lost when it is taken by another owner or not extended within its ttl,
+// when ctx ends first extension stops and the lock is marked with ErrLockExtensionStopped
+func (lk *Lock) startExtending(ctx context.Context) {
+	lk.stop = make(chan struct{})
+	lk.done = make(chan struct{})
+
+	go func() {
+		defer close(lk.done)
+		ticker := time.NewTicker(lk.ttl / 3)
+		defer ticker.Stop()
+
+		extended := time.Now()
+		for {
+			select {
+			case <-lk.stop:
+				return
+			case <-ctx.Done():
+				select {
+				case <-lk.stop:
+				default:
+					lk.setLost(ErrLockExtensionStopped)
+					LogCtx(ctx, WarnLevel, fmt.Sprintf("lock %s extension stopped: %v", lk.key, ctx.Err()), "lock", "extend")
+				}
+				return
+			case <-ticker.C:
+			}
+
+			err := lk.Extend(lk.ttl)
+			if err == nil {
+				extended = time.Now()
+				continue
+			}
+			if err != ErrLockLost && time.Since(extended) < lk.ttl {
+				LogCtx(ctx, WarnLevel, fmt.Sprintf("lock %s extension failed, retrying: %v", lk.key, err), "lock", "extend")
+				continue
+			}
+
+			lk.setLost(ErrLockLost)
+			LogCtx(ctx, WarnLevel, fmt.Sprintf("lock %s lost: %v", lk.key, err), "lock", "extend")
+			return
+		}
+	}()
+}
+
+// stopExtending function for stopping automatic extension and waiting for it
+func (lk *Lock) stopExtending() {
+	if lk.stop == nil {
+		return
+	}
+	lk.stopOnce.Do(func() {
+		close(lk.stop)
+	})
+	<-lk.done
+}
+
+// AcquireLock function for taking lock of key on redis node of DefaultRedisRegistry, see Locker.Acquire
+// ctx context.Context
+// node string redis node of DefaultRedisRegistry
+// key string
+// ttl time.Duration
+// opts ...LockOptions
+func AcquireLock(ctx context.Context, node, key string, ttl time.Duration, opts ...LockOptions) (*Lock, error) {
+	client, err := GetRedis(node)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocker(client).Acquire(ctx, key, ttl, opts...)
+}
@@ -0,0 +1,173 @@
+package golib
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisLocker(t *testing.T) {
+	s, client := newTestRedis(t)
+	defer s.Close()
+	ctx := context.Background()
+	locker := NewLocker(client)
+
+	t.Run("SUCCESS Acquire & Release", func(t *testing.T) {
+		lk, err := locker.Acquire(ctx, "stock", time.Minute)
+		assert.NoError(t, err)
+		assert.Equal(t, "stock", lk.Key())
+		assert.Len(t, lk.Token(), 32)
+		assert.Equal(t, time.Minute, s.TTL(lockPrefix+"stock"))
+
+		_, err = locker.Acquire(ctx, "stock", time.Minute)
+		assert.Equal(t, ErrLockNotAcquired, err)
+
+		assert.NoError(t, lk.Release())
+		assert.False(t, s.Exists(lockPrefix+"stock"))
+		assert.NoError(t, lk.Err())
+	})
+
+	t.Run("LOST Release", func(t *testing.T) {
+		lk, err := locker.Acquire(ctx, "stock", time.Minute)
+		assert.NoError(t, err)
+		s.Set(lockPrefix+"stock", "other")
+
+		assert.Equal(t, ErrLockLost, lk.Release())
+		assert.Equal(t, ErrLockLost, lk.Err())
+		assert.True(t, s.Exists(lockPrefix+"stock"))
+		s.Del(lockPrefix + "stock")
+	})
+
+	t.Run("SUCCESS Extend", func(t *testing.T) {
+		lk, err := locker.Acquire(ctx, "stock", time.Second)
+		assert.NoError(t, err)
+		assert.NoError(t, lk.Extend(time.Minute))
+		assert.Equal(t, time.Minute, s.TTL(lockPrefix+"stock"))
+
+		s.FastForward(2 * time.Minute)
+		assert.Equal(t, ErrLockLost, lk.Extend(time.Minute))
+		assert.Equal(t, ErrLockLost, lk.Release())
+	})
+
+	t.Run("WAIT Acquire", func(t *testing.T) {
+		held, err := locker.Acquire(ctx, "stock", time.Minute)
+		assert.NoError(t, err)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			held.Release()
+		}()
+
+		lk, err := locker.Acquire(ctx, "stock", time.Minute, LockOptions{WaitTimeout: time.Second, RetryInterval: 10 * time.Millisecond})
+		assert.NoError(t, err)
+		assert.NotEqual(t, held.Token(), lk.Token())
+		assert.NoError(t, lk.Release())
+	})
+
+	t.Run("TIMEOUT Acquire", func(t *testing.T) {
+		held, err := locker.Acquire(ctx, "stock", time.Minute)
+		assert.NoError(t, err)
+		defer held.Release()
+
+		start := time.Now()
+		_, err = locker.Acquire(ctx, "stock", time.Minute, LockOptions{WaitTimeout: 100 * time.Millisecond, RetryInterval: 10 * time.Millisecond})
+		assert.Equal(t, ErrLockNotAcquired, err)
+		assert.True(t, time.Since(start) < time.Second)
+
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = locker.Acquire(cancelled, "stock", time.Minute, LockOptions{WaitTimeout: time.Second, RetryInterval: 10 * time.Millisecond})
+		assert.Equal(t, context.Canceled, err)
+	})
+
+	t.Run("AUTO EXTEND Acquire", func(t *testing.T) {
+		lk, err := locker.Acquire(ctx, "stock", 150*time.Millisecond, LockOptions{AutoExtend: true})
+		assert.NoError(t, err)
+
+		s.FastForward(100 * time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, 150*time.Millisecond, s.TTL(lockPrefix+"stock"))
+		assert.NoError(t, lk.Err())
+		assert.NoError(t, lk.Release())
+		assert.NoError(t, lk.Err())
+		select {
+		case <-lk.Lost():
+			t.Error("released lock reported lost")
+		default:
+		}
+	})
+
+	t.Run("AUTO EXTEND LOST", func(t *testing.T) {
+		lk, err := locker.Acquire(ctx, "stock", 150*time.Millisecond, LockOptions{AutoExtend: true})
+		assert.NoError(t, err)
+		s.Set(lockPrefix+"stock", "other")
+
+		select {
+		case <-lk.Lost():
+		case <-time.After(time.Second):
+			t.Fatal("lock not reported lost")
+		}
+		assert.Equal(t, ErrLockLost, lk.Err())
+		assert.Equal(t, ErrLockLost, lk.Release())
+		s.Del(lockPrefix + "stock")
+	})
+
+	t.Run("CANCELLED CTX AUTO EXTEND", func(t *testing.T) {
+		extendCtx, cancel := context.WithCancel(ctx)
+		lk, err := locker.Acquire(extendCtx, "stock", 150*time.Millisecond, LockOptions{AutoExtend: true})
+		assert.NoError(t, err)
+		cancel()
+
+		select {
+		case <-lk.Lost():
+		case <-time.After(time.Second):
+			t.Fatal("extension not stopped")
+		}
+		<-lk.done
+		assert.Equal(t, ErrLockExtensionStopped, lk.Err())
+		s.FastForward(100 * time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		assert.Equal(t, 50*time.Millisecond, s.TTL(lockPrefix+"stock"))
+		assert.NoError(t, lk.Release())
+	})
+
+	t.Run("ERROR Acquire", func(t *testing.T) {
+		_, err := locker.Acquire(ctx, "stock", 0)
+		assert.Error(t, err)
+		_, err = locker.Acquire(ctx, "stock", time.Millisecond, LockOptions{AutoExtend: true})
+		assert.EqualError(t, err, "lock: ttl must be at least 100ms")
+		assert.False(t, s.Exists(lockPrefix+"stock"))
+	})
+
+	t.Run("ERROR Extend", func(t *testing.T) {
+		lk, err := locker.Acquire(ctx, "stock", time.Minute)
+		assert.NoError(t, err)
+		assert.EqualError(t, lk.Extend(0), "lock: ttl must be at least 100ms")
+		assert.Equal(t, time.Minute, s.TTL(lockPrefix+"stock"))
+		assert.NoError(t, lk.Release())
+	})
+}
+
+func TestAcquireLock(t *testing.T) {
+	s, client := newTestRedis(t)
+	defer s.Close()
+	RegisterRedis("lock", client)
+	defer CloseRedisNode("lock")
+
+	t.Run("SUCCESS AcquireLock", func(t *testing.T) {
+		lk, err := AcquireLock(context.Background(), "lock", "reconcile", time.Minute)
+		assert.NoError(t, err)
+		assert.True(t, s.Exists(lockPrefix+"reconcile"))
+		assert.NoError(t, lk.Release())
+	})
+
+	t.Run("ERROR AcquireLock", func(t *testing.T) {
+		os.Setenv("REDIS_lock_down_HOST", "127.0.0.1:1")
+		defer os.Unsetenv("REDIS_lock_down_HOST")
+
+		_, err := AcquireLock(context.Background(), "lock_down", "reconcile", time.Minute)
+		assert.Error(t, err)
+	})
+}
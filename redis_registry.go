@@ -0,0 +1,242 @@
+package golib
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// DefaultRedisRegistry registry used by RedisClient, GetRedis, RegisterRedis, CloseRedisNode and CloseRedis
+var DefaultRedisRegistry = NewRedisRegistry(nil)
+
+// RedisRegistry clients of redis nodes created on first use and shared by every goroutine
+type RedisRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*redisEntry
+	// failed clients returned by lazyClient for nodes whose client can not be created
+	failed  map[string]redis.UniversalClient
+	factory func(node string) (redis.UniversalClient, error)
+}
+
+// redisEntry client of a node, ready is closed once client or err is set
+type redisEntry struct {
+	ready  chan struct{}
+	client redis.UniversalClient
+	err    error
+}
+
+// NewRedisRegistry function for creating registry
+// factory func(node string) (redis.UniversalClient, error) creating client of node, nil reads RedisConfigFromEnv
+func NewRedisRegistry(factory func(node string) (redis.UniversalClient, error)) *RedisRegistry {
+	if factory == nil {
+		factory = redisClientFromEnv
+	}
+	return &RedisRegistry{entries: map[string]*redisEntry{}, failed: map[string]redis.UniversalClient{}, factory: factory}
+}
+
+// redisClientFromEnv function for creating client of node configured by environment variables
+func redisClientFromEnv(node string) (redis.UniversalClient, error) {
+	cfg, err := RedisConfigFromEnv(node)
+	if err != nil {
+		return nil, err
+	}
+	return NewRedisClient(cfg)
+}
+
+// Get function for getting client of node, the client is created and pinged on first use,
+// concurrent callers wait for the same creation and a failed creation is retried by the next call
+// node string
+func (r *RedisRegistry) Get(node string) (redis.UniversalClient, error) {
+	return r.get(node, true)
+}
+
+// GetLazy function for getting client of node without waiting for redis, a client created by GetLazy
+// is not pinged and connects on its first command, errors of the factory are returned
+// node string
+func (r *RedisRegistry) GetLazy(node string) (redis.UniversalClient, error) {
+	return r.get(node, false)
+}
+
+// lazyClient function for getting client of node like GetLazy, when the client can not be created
+// the error is logged once and a client failing every command with it is kept until Close or Register of node
+func (r *RedisRegistry) lazyClient(node string) redis.UniversalClient {
+	r.mu.Lock()
+	failed, ok := r.failed[node]
+	r.mu.Unlock()
+	if ok {
+		return failed
+	}
+
+	client, err := r.GetLazy(node)
+	if err == nil {
+		return client
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if failed, ok := r.failed[node]; ok {
+		return failed
+	}
+	LogError(err, "redis", node)
+	// a negative idle timeout disables the idle connection reaper goroutine of the client
+	failed = redis.NewClient(&redis.Options{
+		IdleTimeout: -1,
+		Dialer: func() (net.Conn, error) {
+			return nil, err
+		},
+	})
+	r.failed[node] = failed
+	return failed
+}
+
+// dropFailed function for closing failed client of node, caller holds r.mu
+func (r *RedisRegistry) dropFailed(node string) {
+	if failed, ok := r.failed[node]; ok {
+		failed.Close()
+		delete(r.failed, node)
+	}
+}
+
+// get function for getting client of node, creating it when node has none
+func (r *RedisRegistry) get(node string, ping bool) (redis.UniversalClient, error) {
+	r.mu.Lock()
+	e, ok := r.entries[node]
+	if ok {
+		r.mu.Unlock()
+		<-e.ready
+		return e.client, e.err
+	}
+
+	e = &redisEntry{ready: make(chan struct{})}
+	r.entries[node] = e
+	r.mu.Unlock()
+
+	client, err := r.create(node, ping)
+
+	// the registration is checked again because Close or Register may have removed the entry while it was created
+	r.mu.Lock()
+	current := r.entries[node] == e
+	if err != nil && current {
+		delete(r.entries, node)
+	}
+	r.mu.Unlock()
+
+	if err == nil && !current {
+		client.Close()
+		client, err = nil, fmt.Errorf("redis node %s was closed while connecting", node)
+	}
+	e.client, e.err = client, err
+	close(e.ready)
+	return e.client, e.err
+}
+
+// create function for creating client of node, pinged when ping is set
+func (r *RedisRegistry) create(node string, ping bool) (redis.UniversalClient, error) {
+	client, err := r.factory(node)
+	if err != nil {
+		return nil, err
+	}
+	if !ping {
+		return client, nil
+	}
+	if err := client.Ping().Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("redis node %s is unreachable: %v", node, err)
+	}
+	return client, nil
+}
+
+// Register function for adding already created client of node such as a client of miniredis in tests,
+// the registry owns the client and a client previously registered for node is closed
+// node string
+// client redis.UniversalClient
+func (r *RedisRegistry) Register(node string, client redis.UniversalClient) {
+	e := &redisEntry{ready: make(chan struct{}), client: client}
+	close(e.ready)
+
+	r.mu.Lock()
+	old := r.entries[node]
+	r.entries[node] = e
+	r.dropFailed(node)
+	r.mu.Unlock()
+
+	if old != nil {
+		<-old.ready
+		if old.client != nil && old.client != client {
+			old.client.Close()
+		}
+	}
+}
+
+// Close function for closing client of node and removing it, the next Get creates a new client
+// and the next RedisClient reads the configuration of node again
+// node string
+func (r *RedisRegistry) Close(node string) error {
+	r.mu.Lock()
+	e, ok := r.entries[node]
+	delete(r.entries, node)
+	r.dropFailed(node)
+	r.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	<-e.ready
+	if e.client == nil {
+		return nil
+	}
+	return e.client.Close()
+}
+
+// CloseAll function for closing and removing client of every node
+func (r *RedisRegistry) CloseAll() error {
+	r.mu.Lock()
+	for node := range r.failed {
+		r.dropFailed(node)
+	}
+	r.mu.Unlock()
+
+	errs := NewMultiError()
+	for _, node := range r.Nodes() {
+		errs.Append(node, r.Close(node))
+	}
+	if errs.HasError() {
+		return errs
+	}
+	return nil
+}
+
+// Nodes function for getting names of registered nodes
+func (r *RedisRegistry) Nodes() []string {
+	r.mu.Lock()
+	nodes := make([]string, 0, len(r.entries))
+	for node := range r.entries {
+		nodes = append(nodes, node)
+	}
+	r.mu.Unlock()
+
+	sort.Strings(nodes)
+	return nodes
+}
+
+// GetRedis function for getting client of node from DefaultRedisRegistry
+// node string
+func GetRedis(node string) (redis.UniversalClient, error) {
+	return DefaultRedisRegistry.Get(node)
+}
+
+// RegisterRedis function for adding already created client of node into DefaultRedisRegistry
+// node string
+// client redis.UniversalClient
+func RegisterRedis(node string, client redis.UniversalClient) {
+	DefaultRedisRegistry.Register(node, client)
+}
+
+// CloseRedisNode function for closing client of node of DefaultRedisRegistry
+// node string
+func CloseRedisNode(node string) error {
+	return DefaultRedisRegistry.Close(node)
+}
@@ -0,0 +1,127 @@
+package golib
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisRegistry(t *testing.T) {
+	s, _ := newTestRedis(t)
+	defer s.Close()
+
+	var created int32
+	registry := NewRedisRegistry(func(node string) (redis.UniversalClient, error) {
+		atomic.AddInt32(&created, 1)
+		if node == "invalid" {
+			return nil, errors.New("invalid config")
+		}
+		if node == "down" {
+			return redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"}), nil
+		}
+		return redis.NewClient(&redis.Options{Addr: s.Addr()}), nil
+	})
+	defer registry.CloseAll()
+
+	t.Run("CONCURRENT Get", func(t *testing.T) {
+		var wg sync.WaitGroup
+		clients := make([]redis.UniversalClient, 20)
+		for i := range clients {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				c, err := registry.Get("cache")
+				assert.NoError(t, err)
+				clients[i] = c
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&created))
+		for _, c := range clients {
+			assert.True(t, c == clients[0])
+		}
+	})
+
+	t.Run("ERROR Get", func(t *testing.T) {
+		_, err := registry.Get("invalid")
+		assert.EqualError(t, err, "invalid config")
+
+		_, err = registry.Get("down")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "redis node down is unreachable")
+		assert.NotContains(t, registry.Nodes(), "down")
+	})
+
+	t.Run("SUCCESS Close", func(t *testing.T) {
+		c, _ := registry.Get("cache")
+		assert.NoError(t, registry.Close("cache"))
+		assert.NotContains(t, registry.Nodes(), "cache")
+		assert.Error(t, c.Ping().Err())
+
+		fresh, err := registry.Get("cache")
+		assert.NoError(t, err)
+		assert.NoError(t, fresh.Ping().Err())
+		assert.NoError(t, registry.Close("unknown"))
+	})
+
+	t.Run("SUCCESS Register", func(t *testing.T) {
+		old, _ := registry.Get("cache")
+		client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+		registry.Register("cache", client)
+
+		c, err := registry.Get("cache")
+		assert.NoError(t, err)
+		assert.True(t, c == client)
+		assert.Error(t, old.Ping().Err())
+	})
+
+	t.Run("SUCCESS CloseAll", func(t *testing.T) {
+		_, _ = registry.Get("session")
+		assert.NoError(t, registry.CloseAll())
+		assert.Empty(t, registry.Nodes())
+	})
+}
+
+func TestRedisRegistryCloseWhileConnecting(t *testing.T) {
+	s, _ := newTestRedis(t)
+	defer s.Close()
+
+	release := make(chan struct{})
+	var created redis.UniversalClient
+	registry := NewRedisRegistry(func(node string) (redis.UniversalClient, error) {
+		<-release
+		created = redis.NewClient(&redis.Options{Addr: s.Addr()})
+		return created, nil
+	})
+
+	t.Run("CLOSED Get", func(t *testing.T) {
+		result := make(chan error, 1)
+		go func() {
+			_, err := registry.Get("cache")
+			result <- err
+		}()
+		for len(registry.Nodes()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		closed := make(chan error, 1)
+		go func() {
+			closed <- registry.Close("cache")
+		}()
+		for len(registry.Nodes()) != 0 {
+			time.Sleep(time.Millisecond)
+		}
+		close(release)
+
+		assert.EqualError(t, <-result, "redis node cache was closed while connecting")
+		assert.NoError(t, <-closed)
+		assert.Error(t, created.Ping().Err())
+		assert.Empty(t, registry.Nodes())
+	})
+}
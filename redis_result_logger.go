@@ -0,0 +1,173 @@
+package golib
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+const (
+	// ResultLoggerFile backend storing payloads on local disk
+	ResultLoggerFile = "file"
+	// ResultLoggerRedis backend storing payloads in redis
+	ResultLoggerRedis = "redis"
+
+	defaultResultLoggerPrefix = "golib:result"
+	defaultResultLoggerTTL    = 7 * 24 * time.Hour
+)
+
+// ResultLoggerConfig configuration used by NewResultLogger to choose the backend
+type ResultLoggerConfig struct {
+	// Backend ResultLoggerFile (default) or ResultLoggerRedis
+	Backend string
+	// BaseDir directory of file backend
+	BaseDir string
+	// RedisNode node name passed to RedisClient
+	RedisNode string
+	// Prefix of redis keys, default "golib:result"
+	Prefix string
+	// TTL of redis payloads, default 7 days
+	TTL time.Duration
+}
+
+// RedisResultLogger redis based storage
+type RedisResultLogger struct {
+	mu        sync.Mutex
+	client    redis.UniversalClient
+	prefix    string
+	ttl       time.Duration
+	lastError error
+}
+
+// redisResultSequence sequence appended into payload keys, keeps keys unique within the same nanosecond
+var redisResultSequence uint64
+
+// ResultLoggerConfigFromEnv function for reading result logger configuration from environment:
+// RESULT_LOGGER, LOG_DIR, RESULT_LOGGER_REDIS_NODE, RESULT_LOGGER_PREFIX and RESULT_LOGGER_TTL (seconds)
+func ResultLoggerConfigFromEnv() ResultLoggerConfig {
+	base := os.Getenv("LOG_DIR")
+	if base == "" {
+		base = os.Getenv("STORAGE_DIR") + "/logs/"
+	}
+	ttl, _ := strconv.Atoi(os.Getenv("RESULT_LOGGER_TTL"))
+
+	return ResultLoggerConfig{
+		Backend:   os.Getenv("RESULT_LOGGER"),
+		BaseDir:   base,
+		RedisNode: os.Getenv("RESULT_LOGGER_REDIS_NODE"),
+		Prefix:    os.Getenv("RESULT_LOGGER_PREFIX"),
+		TTL:       time.Duration(ttl) * time.Second,
+	}
+}
+
+// NewResultLogger function for creating result logger of the configured backend,
+// the redis backend connects on its first command and reports redis errors by LastError, it never falls back to files
+func NewResultLogger(cfg ResultLoggerConfig) ResultLogger {
+	if cfg.Backend == ResultLoggerRedis {
+		return NewRedisResultLogger(RedisClient(cfg.RedisNode), cfg.Prefix, cfg.TTL)
+	}
+	return newFileResultLogger(cfg.BaseDir)
+}
+
+// NewRedisResultLogger function for creating redis based result logger
+// client redis.UniversalClient
+// prefix string prefix of keys, default "golib:result"
+// ttl time.Duration expiration of stored payloads, default 7 days
+func NewRedisResultLogger(client redis.UniversalClient, prefix string, ttl time.Duration) *RedisResultLogger {
+	if prefix == "" {
+		prefix = defaultResultLoggerPrefix
+	}
+	if ttl <= 0 {
+		ttl = defaultResultLoggerTTL
+	}
+	return &RedisResultLogger{client: client, prefix: prefix, ttl: ttl}
+}
+
+// LastError function for getting last error
+func (rlo *RedisResultLogger) LastError() error {
+	rlo.mu.Lock()
+	defer rlo.mu.Unlock()
+	return rlo.lastError
+}
+
+// setLastError function for setting last error
+func (rlo *RedisResultLogger) setLastError(err error) {
+	rlo.mu.Lock()
+	rlo.lastError = err
+	rlo.mu.Unlock()
+}
+
+// indexKey function for getting key of sorted set indexing payloads of a code
+func (rlo *RedisResultLogger) indexKey(c string) string {
+	return fmt.Sprintf("%s:index:%s", rlo.prefix, c)
+}
+
+// Store function to store payload, the returned key is accepted by Get
+// c string code name
+// d []byte json data which is about to stored
+func (rlo *RedisResultLogger) Store(c string, d []byte) string {
+	t := time.Now()
+	key := fmt.Sprintf("%s:data:%s:%d-%d", rlo.prefix, c, t.UnixNano(), atomic.AddUint64(&redisResultSequence, 1))
+	index := rlo.indexKey(c)
+
+	pipe := rlo.client.TxPipeline()
+	pipe.Set(key, d, rlo.ttl)
+	pipe.ZAdd(index, redis.Z{Score: float64(unixMilli(t)), Member: key})
+	// drop index members whose payload has expired
+	pipe.ZRemRangeByScore(index, "-inf", fmt.Sprintf("(%d", unixMilli(t.Add(-rlo.ttl))))
+	pipe.Expire(index, rlo.ttl)
+	_, err := pipe.Exec()
+	rlo.setLastError(err)
+
+	return key
+}
+
+// Get function to get stored payload
+// p string key returned by Store
+func (rlo *RedisResultLogger) Get(p string) string {
+	data, err := rlo.client.Get(p).Result()
+	if err != nil {
+		rlo.setLastError(err)
+		return ""
+	}
+
+	rlo.setLastError(nil)
+	return data
+}
+
+// RequestResponse function for appending request and response into daily key of the code
+// c string code name
+// dt string request and response data
+func (rlo *RedisResultLogger) RequestResponse(c string, dt string) string {
+	t := time.Now()
+	key := fmt.Sprintf("%s:rr:%s:%s", rlo.prefix, c, t.Format("20060102"))
+	val := fmt.Sprintf("%s : %s", t.Format("15:04:05"), dt)
+
+	pipe := rlo.client.TxPipeline()
+	pipe.Append(key, val)
+	pipe.Expire(key, rlo.ttl)
+	_, err := pipe.Exec()
+	rlo.setLastError(err)
+
+	return ""
+}
+
+// Keys function for listing keys of payloads stored for the code within the time window, oldest first
+// c string code name
+// from time.Time start of window, zero value means no lower bound
+// to time.Time end of window, zero value means no upper bound
+func (rlo *RedisResultLogger) Keys(c string, from, to time.Time) ([]string, error) {
+	keys, err := rlo.client.ZRangeByScore(rlo.indexKey(c), windowRange(from, to)).Result()
+	rlo.setLastError(err)
+	return keys, err
+}
+
+// unixMilli function for getting unix time in milliseconds
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,121 @@
+package golib
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	"github.com/go-redis/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, redis.NewClient(&redis.Options{Addr: s.Addr()})
+}
+
+func TestRedisResultLogger(t *testing.T) {
+	s, client := newTestRedis(t)
+	defer s.Close()
+
+	t.Run("SUCCESS Store & Get", func(t *testing.T) {
+		rl := NewRedisResultLogger(client, "", time.Hour)
+		key := rl.Store("order", []byte(`{"id":1}`))
+		assert.NoError(t, rl.LastError())
+		assert.Equal(t, `{"id":1}`, rl.Get(key))
+		assert.Equal(t, time.Hour, s.TTL(key))
+	})
+
+	t.Run("ERROR Get", func(t *testing.T) {
+		rl := NewRedisResultLogger(client, "", 0)
+		assert.Equal(t, "", rl.Get("unknown"))
+		assert.Error(t, rl.LastError())
+	})
+
+	t.Run("SUCCESS Keys", func(t *testing.T) {
+		rl := NewRedisResultLogger(client, "test", time.Hour)
+		first := rl.Store("payment", []byte("1"))
+		second := rl.Store("payment", []byte("2"))
+		rl.Store("other", []byte("3"))
+
+		keys, err := rl.Keys("payment", time.Time{}, time.Time{})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{first, second}, keys)
+
+		keys, err = rl.Keys("payment", time.Now().Add(time.Minute), time.Time{})
+		assert.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+
+	t.Run("SUCCESS RequestResponse", func(t *testing.T) {
+		rl := NewRedisResultLogger(client, "test", time.Hour)
+		rl.RequestResponse("200", "first\n")
+		rl.RequestResponse("200", "second\n")
+		assert.NoError(t, rl.LastError())
+
+		val, err := s.Get("test:rr:200:" + time.Now().Format("20060102"))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, strings.Count(val, " : "))
+	})
+}
+
+func TestNewResultLogger(t *testing.T) {
+	t.Run("FILE NewResultLogger", func(t *testing.T) {
+		_, ok := NewResultLogger(ResultLoggerConfig{BaseDir: os.TempDir()}).(*FileResultLogger)
+		assert.True(t, ok)
+	})
+
+	t.Run("REDIS NewResultLogger", func(t *testing.T) {
+		s, client := newTestRedis(t)
+		defer s.Close()
+		RegisterRedis("result", client)
+		defer CloseRedisNode("result")
+
+		_, ok := NewResultLogger(ResultLoggerConfig{Backend: ResultLoggerRedis, RedisNode: "result"}).(*RedisResultLogger)
+		assert.True(t, ok)
+	})
+
+	t.Run("NO FALLBACK NewResultLogger", func(t *testing.T) {
+		os.Setenv("REDIS_result_down_HOST", "127.0.0.1:1")
+		defer os.Unsetenv("REDIS_result_down_HOST")
+		defer CloseRedisNode("result_down")
+
+		rl, ok := NewResultLogger(ResultLoggerConfig{Backend: ResultLoggerRedis, RedisNode: "result_down", BaseDir: os.TempDir()}).(*RedisResultLogger)
+		assert.True(t, ok)
+		rl.Store("200", []byte("{}"))
+		assert.Error(t, rl.LastError())
+	})
+
+	t.Run("CACHED GetResultLogger", func(t *testing.T) {
+		s, client := newTestRedis(t)
+		defer s.Close()
+		RegisterRedis("result_cached", client)
+		defer CloseRedisNode("result_cached")
+		os.Setenv("RESULT_LOGGER", ResultLoggerRedis)
+		os.Setenv("RESULT_LOGGER_REDIS_NODE", "result_cached")
+		defer os.Unsetenv("RESULT_LOGGER")
+		defer os.Unsetenv("RESULT_LOGGER_REDIS_NODE")
+
+		rl := GetResultLogger()
+		assert.True(t, rl == GetResultLogger())
+		assert.Equal(t, "", StoreRequestResponse("200", []byte("req"), []byte("res")))
+		assert.NoError(t, rl.LastError())
+		assert.Len(t, s.Keys(), 1)
+	})
+
+	t.Run("ENV ResultLoggerConfigFromEnv", func(t *testing.T) {
+		os.Setenv("RESULT_LOGGER", "redis")
+		os.Setenv("RESULT_LOGGER_TTL", "60")
+		defer os.Unsetenv("RESULT_LOGGER")
+		defer os.Unsetenv("RESULT_LOGGER_TTL")
+
+		cfg := ResultLoggerConfigFromEnv()
+		assert.Equal(t, ResultLoggerRedis, cfg.Backend)
+		assert.Equal(t, time.Minute, cfg.TTL)
+	})
+}
@@ -1,32 +1,244 @@
 package golib
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/go-redis/redis"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestRedisClient(t *testing.T) {
-	client := redis.NewClient(&redis.Options{})
-	redisClient = make(map[string]*redis.Client)
-	redisClient["test"] = client
+	s, client := newTestRedis(t)
+	defer s.Close()
+	RegisterRedis("test", client)
+	defer CloseRedis()
 
 	t.Run("OK NODE RedisClient", func(t *testing.T) {
 		assert.Equal(t, client, RedisClient("test"))
 	})
 
 	t.Run("NOK NODE RedisClient", func(t *testing.T) {
+		os.Setenv("REDIS_new_HOST", s.Addr())
+		defer os.Unsetenv("REDIS_new_HOST")
+
 		assert.NotEqual(t, client, RedisClient("new"))
 	})
+
+	t.Run("UNREACHABLE RedisClient", func(t *testing.T) {
+		os.Setenv("REDIS_down_HOST", "127.0.0.1:1")
+		defer os.Unsetenv("REDIS_down_HOST")
+
+		var client redis.UniversalClient
+		assert.NotPanics(t, func() { client = RedisClient("down") })
+		assert.Error(t, client.Ping().Err())
+		assert.Equal(t, client, RedisClient("down"))
+
+		os.Setenv("REDIS_down_ping_HOST", "127.0.0.1:1")
+		defer os.Unsetenv("REDIS_down_ping_HOST")
+		_, err := GetRedis("down_ping")
+		assert.Error(t, err)
+	})
+
+	t.Run("INVALID CONFIG RedisClient", func(t *testing.T) {
+		os.Setenv("REDIS_invalid_MODE", "ring")
+		defer os.Unsetenv("REDIS_invalid_MODE")
+
+		var client redis.UniversalClient
+		assert.NotPanics(t, func() { client = RedisClient("invalid") })
+		assert.EqualError(t, client.Ping().Err(), `invalid redis config: unsupported mode "ring"`)
+
+		goroutines := runtime.NumGoroutine()
+		for i := 0; i < 50; i++ {
+			assert.True(t, RedisClient("invalid") == client)
+		}
+		assert.True(t, runtime.NumGoroutine() <= goroutines)
+
+		assert.NoError(t, CloseRedisNode("invalid"))
+		assert.False(t, RedisClient("invalid") == client)
+		assert.NoError(t, CloseRedisNode("invalid"))
+	})
 }
 
 func TestCloseRedis(t *testing.T) {
-	client := redis.NewClient(&redis.Options{})
-	redisClient = make(map[string]*redis.Client)
-	redisClient["test"] = client
+	s, client := newTestRedis(t)
+	defer s.Close()
+	RegisterRedis("test", client)
 
 	t.Run("OK CloseRedis", func(t *testing.T) {
 		CloseRedis()
+		assert.Empty(t, DefaultRedisRegistry.Nodes())
+	})
+}
+
+func TestRedisConfigFromEnv(t *testing.T) {
+	t.Run("STANDALONE RedisConfigFromEnv", func(t *testing.T) {
+		os.Setenv("REDIS_TEST_HOST", "localhost:6379")
+		os.Setenv("REDIS_TEST_DB", "2")
+		os.Setenv("REDIS_TEST_IDLE_TIMEOUT", "30")
+		defer os.Unsetenv("REDIS_TEST_HOST")
+		defer os.Unsetenv("REDIS_TEST_DB")
+		defer os.Unsetenv("REDIS_TEST_IDLE_TIMEOUT")
+
+		cfg, err := RedisConfigFromEnv("TEST")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"localhost:6379"}, cfg.Addrs)
+		assert.Equal(t, 2, cfg.DB)
+		assert.Equal(t, 30*time.Second, cfg.IdleTimeout)
+	})
+
+	t.Run("SENTINEL RedisConfigFromEnv", func(t *testing.T) {
+		os.Setenv("REDIS_TEST_MODE", "sentinel")
+		os.Setenv("REDIS_TEST_MASTER_NAME", "mymaster")
+		os.Setenv("REDIS_TEST_ADDRS", "s1:26379, s2:26379,")
+		defer os.Unsetenv("REDIS_TEST_MODE")
+		defer os.Unsetenv("REDIS_TEST_MASTER_NAME")
+		defer os.Unsetenv("REDIS_TEST_ADDRS")
+
+		cfg, err := RedisConfigFromEnv("TEST")
+		assert.NoError(t, err)
+		assert.Equal(t, RedisSentinel, cfg.Mode)
+		assert.Equal(t, "mymaster", cfg.MasterName)
+		assert.Equal(t, []string{"s1:26379", "s2:26379"}, cfg.Addrs)
+	})
+
+	t.Run("ERROR RedisConfigFromEnv", func(t *testing.T) {
+		os.Setenv("REDIS_TEST_READ_ONLY", "maybe")
+		defer os.Unsetenv("REDIS_TEST_READ_ONLY")
+
+		_, err := RedisConfigFromEnv("TEST")
+		assert.Error(t, err)
+	})
+}
+
+func TestNewRedisClient(t *testing.T) {
+	t.Run("SUCCESS NewRedisClient", func(t *testing.T) {
+		client, err := NewRedisClient(RedisConfig{Addrs: []string{"localhost:6379"}})
+		assert.NoError(t, err)
+		assert.IsType(t, &redis.Client{}, client)
+		client.Close()
+
+		client, err = NewRedisClient(RedisConfig{Mode: RedisSentinel, MasterName: "mymaster", Addrs: []string{"s1:26379"}})
+		assert.NoError(t, err)
+		assert.IsType(t, &redis.Client{}, client)
+		client.Close()
+
+		client, err = NewRedisClient(RedisConfig{Mode: RedisCluster, Addrs: []string{"c1:7000"}})
+		assert.NoError(t, err)
+		assert.IsType(t, &redis.ClusterClient{}, client)
+		client.Close()
+	})
+
+	t.Run("ERROR NewRedisClient", func(t *testing.T) {
+		for _, cfg := range []RedisConfig{
+			{Mode: "ring"},
+			{Addrs: []string{"a:6379", "b:6379"}},
+			{Mode: RedisSentinel, Addrs: []string{"s1:26379"}},
+			{Mode: RedisSentinel, MasterName: "mymaster"},
+			{Mode: RedisCluster},
+			{Mode: RedisCluster, Addrs: []string{"c1:7000"}, DB: 1},
+		} {
+			_, err := NewRedisClient(cfg)
+			assert.Error(t, err, "%+v", cfg)
+		}
+	})
+}
+
+func writeTestCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "redis.local"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	assert.NoError(t, ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+func TestRedisConfigTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redis-tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certPath, keyPath := writeTestCert(t, dir)
+
+	t.Run("VERIFIED tlsConfig", func(t *testing.T) {
+		conf, err := RedisConfig{TLS: true}.tlsConfig()
+		assert.NoError(t, err)
+		assert.False(t, conf.InsecureSkipVerify)
+		assert.Equal(t, uint16(tls.VersionTLS12), conf.MinVersion)
+	})
+
+	t.Run("MUTUAL tlsConfig", func(t *testing.T) {
+		cfg := RedisConfig{TLS: true, TLSCACert: certPath, TLSCert: certPath, TLSKey: keyPath, TLSServerName: "redis.local", TLSMinVersion: "1.3"}
+		conf, err := cfg.tlsConfig()
+		assert.NoError(t, err)
+		assert.NotNil(t, conf.RootCAs)
+		assert.Len(t, conf.Certificates, 1)
+		assert.Equal(t, "redis.local", conf.ServerName)
+		assert.Equal(t, uint16(tls.VersionTLS13), conf.MinVersion)
+	})
+
+	t.Run("SKIP VERIFY tlsConfig", func(t *testing.T) {
+		conf, err := RedisConfig{TLS: true, TLSInsecureSkipVerify: true}.tlsConfig()
+		assert.NoError(t, err)
+		assert.True(t, conf.InsecureSkipVerify)
+	})
+
+	t.Run("DISABLED tlsConfig", func(t *testing.T) {
+		conf, err := RedisConfig{}.tlsConfig()
+		assert.NoError(t, err)
+		assert.Nil(t, conf)
+	})
+
+	t.Run("ERROR NewRedisClient", func(t *testing.T) {
+		for _, cfg := range []RedisConfig{
+			{TLS: true, TLSCACert: filepath.Join(dir, "missing.pem")},
+			{TLS: true, TLSCACert: keyPath},
+			{TLS: true, TLSCert: certPath, TLSKey: filepath.Join(dir, "missing.pem")},
+			{TLS: true, TLSCert: certPath},
+			{TLS: true, TLSMinVersion: "2.0"},
+			{TLSInsecureSkipVerify: true},
+		} {
+			_, err := NewRedisClient(cfg)
+			assert.Error(t, err, "%+v", cfg)
+		}
+	})
+
+	t.Run("ENV RedisConfigFromEnv", func(t *testing.T) {
+		os.Setenv("REDIS_TLS_TLS", "true")
+		os.Setenv("REDIS_TLS_TLS_CA", certPath)
+		os.Setenv("REDIS_TLS_TLS_SKIP_VERIFY", "false")
+		defer os.Unsetenv("REDIS_TLS_TLS")
+		defer os.Unsetenv("REDIS_TLS_TLS_CA")
+		defer os.Unsetenv("REDIS_TLS_TLS_SKIP_VERIFY")
+
+		cfg, err := RedisConfigFromEnv("TLS")
+		assert.NoError(t, err)
+		assert.True(t, cfg.TLS)
+		assert.False(t, cfg.TLSInsecureSkipVerify)
+		assert.Equal(t, certPath, cfg.TLSCACert)
 	})
 }
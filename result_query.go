@@ -0,0 +1,268 @@
+package golib
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// ErrStopQuery returned by a Query callback to stop iterating without error
+var ErrStopQuery = errors.New("stop query")
+
+// ResultQuery filter of payloads stored by ResultLogger
+type ResultQuery struct {
+	// Code of stored payloads, required
+	Code string
+	// From start of time window, zero value means no lower bound
+	From time.Time
+	// To end of time window, zero value means no upper bound
+	To time.Time
+	// Contains substring the payload must contain, empty matches everything
+	Contains string
+	// Limit maximum number of entries, zero means unlimited
+	Limit int
+}
+
+// ResultEntry payload stored by ResultLogger
+type ResultEntry struct {
+	// ID stable identifier accepted by ResultLogger.Get
+	ID       string
+	Code     string
+	StoredAt time.Time
+	Size     int64
+}
+
+// fileResult stored file found by query
+type fileResult struct {
+	entry ResultEntry
+	path  string
+	seq   uint64
+}
+
+// ListResults function for listing entries matching the query without their payloads
+func ListResults(rl ResultLogger, q ResultQuery) ([]ResultEntry, error) {
+	var entries []ResultEntry
+	err := rl.Query(q, func(entry ResultEntry, payload io.Reader) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// validate function for checking the query
+func (q ResultQuery) validate() error {
+	if q.Code == "" {
+		return errors.New("result query requires code")
+	}
+	if strings.Contains(q.Code, "/") || strings.Contains(q.Code, "..") {
+		return errors.New("result query code is invalid")
+	}
+	return nil
+}
+
+// inWindow function for checking whether t is inside the query time window
+func (q ResultQuery) inWindow(t time.Time) bool {
+	if !q.From.IsZero() && t.Before(q.From) {
+		return false
+	}
+	return q.To.IsZero() || !t.After(q.To)
+}
+
+// Query function for streaming payloads stored by Store matching the query, oldest first
+// q ResultQuery filter
+// fn func callback receiving every matching entry and its payload, returning ErrStopQuery stops iteration
+func (flo *FileResultLogger) Query(q ResultQuery, fn func(entry ResultEntry, payload io.Reader) error) error {
+	err := flo.query(q, fn)
+	if err == ErrStopQuery {
+		err = nil
+	}
+	flo.setLastError(err)
+	return err
+}
+
+func (flo *FileResultLogger) query(q ResultQuery, fn func(entry ResultEntry, payload io.Reader) error) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+
+	dir := filepath.Join(flo.baseDir, q.Code)
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	results := make([]fileResult, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		storedAt, seq := parseStoredFileName(info)
+		if !q.inWindow(storedAt) {
+			continue
+		}
+		results = append(results, fileResult{
+			entry: ResultEntry{
+				ID:       q.Code + "/" + info.Name(),
+				Code:     q.Code,
+				StoredAt: storedAt,
+				Size:     info.Size(),
+			},
+			path: filepath.Join(dir, info.Name()),
+			seq:  seq,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].entry.StoredAt.Equal(results[j].entry.StoredAt) {
+			return results[i].seq < results[j].seq
+		}
+		return results[i].entry.StoredAt.Before(results[j].entry.StoredAt)
+	})
+
+	matched := 0
+	for _, r := range results {
+		if q.Limit > 0 && matched >= q.Limit {
+			return nil
+		}
+
+		ok, err := streamStoredFile(r, q.Contains, fn)
+		if err != nil {
+			return err
+		}
+		if ok {
+			matched++
+		}
+	}
+	return nil
+}
+
+// streamStoredFile function for passing stored file to the callback when it contains the substring
+func streamStoredFile(r fileResult, contains string, fn func(entry ResultEntry, payload io.Reader) error) (bool, error) {
+	f, err := os.Open(r.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// removed by retention while querying
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	if contains == "" {
+		return true, fn(r.entry, f)
+	}
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Contains(data, []byte(contains)) {
+		return false, nil
+	}
+	return true, fn(r.entry, bytes.NewReader(data))
+}
+
+// parseStoredFileName function for getting store time and sequence from "HHMMSS_<unix>_<seq>.<code>",
+// modification time is used for files written by older versions
+func parseStoredFileName(info os.FileInfo) (time.Time, uint64) {
+	name := info.Name()
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[:i]
+	}
+
+	parts := strings.Split(name, "_")
+	if len(parts) < 2 {
+		return info.ModTime(), 0
+	}
+
+	unix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return info.ModTime(), 0
+	}
+
+	var seq uint64
+	if len(parts) > 2 {
+		seq, _ = strconv.ParseUint(parts[2], 10, 64)
+	}
+	return time.Unix(unix, 0), seq
+}
+
+// Query function for streaming payloads stored by Store matching the query, oldest first
+// q ResultQuery filter
+// fn func callback receiving every matching entry and its payload, returning ErrStopQuery stops iteration
+func (rlo *RedisResultLogger) Query(q ResultQuery, fn func(entry ResultEntry, payload io.Reader) error) error {
+	err := rlo.query(q, fn)
+	if err == ErrStopQuery {
+		err = nil
+	}
+	rlo.setLastError(err)
+	return err
+}
+
+func (rlo *RedisResultLogger) query(q ResultQuery, fn func(entry ResultEntry, payload io.Reader) error) error {
+	if err := q.validate(); err != nil {
+		return err
+	}
+
+	members, err := rlo.client.ZRangeByScoreWithScores(rlo.indexKey(q.Code), windowRange(q.From, q.To)).Result()
+	if err != nil {
+		return err
+	}
+
+	matched := 0
+	for _, m := range members {
+		if q.Limit > 0 && matched >= q.Limit {
+			return nil
+		}
+
+		key, _ := m.Member.(string)
+		data, err := rlo.client.Get(key).Result()
+		if err == redis.Nil {
+			// expired after being indexed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if q.Contains != "" && !strings.Contains(data, q.Contains) {
+			continue
+		}
+
+		matched++
+		entry := ResultEntry{
+			ID:       key,
+			Code:     q.Code,
+			StoredAt: time.Unix(0, int64(m.Score)*int64(time.Millisecond)),
+			Size:     int64(len(data)),
+		}
+		if err := fn(entry, strings.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// windowRange function for building sorted set range of the time window
+func windowRange(from, to time.Time) redis.ZRangeBy {
+	r := redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !from.IsZero() {
+		r.Min = strconv.FormatInt(unixMilli(from), 10)
+	}
+	if !to.IsZero() {
+		r.Max = strconv.FormatInt(unixMilli(to), 10)
+	}
+	return r
+}
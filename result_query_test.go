@@ -0,0 +1,115 @@
+package golib
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileResultLogger_Query(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "golib")
+	defer os.RemoveAll(dir)
+
+	f := newFileResultLogger(dir)
+	first := f.Store("partner", []byte(`{"order":"SO-1"}`))
+	second := f.Store("partner", []byte(`{"order":"SO-2"}`))
+	f.Store("other", []byte(`{"order":"SO-1"}`))
+
+	t.Run("SUCCESS ROUND TRIP Store & Get", func(t *testing.T) {
+		assert.Equal(t, `{"order":"SO-1"}`, f.Get(first))
+		assert.NoError(t, f.LastError())
+		assert.Equal(t, `{"order":"SO-2"}`, f.Get(filepath.Join(dir, second)))
+	})
+
+	t.Run("ERROR TRAVERSAL Get", func(t *testing.T) {
+		assert.Equal(t, "", f.Get("../../etc/passwd"))
+		assert.Error(t, f.LastError())
+	})
+
+	t.Run("SUCCESS LIST Query", func(t *testing.T) {
+		entries, err := ListResults(f, ResultQuery{Code: "partner"})
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, first, entries[0].ID)
+			assert.Equal(t, second, entries[1].ID)
+			assert.Equal(t, "partner", entries[0].Code)
+		}
+	})
+
+	t.Run("SUCCESS CONTAINS Query", func(t *testing.T) {
+		var payloads []string
+		err := f.Query(ResultQuery{Code: "partner", Contains: "SO-2"}, func(entry ResultEntry, payload io.Reader) error {
+			b, _ := ioutil.ReadAll(payload)
+			payloads = append(payloads, string(b))
+			assert.Equal(t, `{"order":"SO-2"}`, f.Get(entry.ID))
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{`{"order":"SO-2"}`}, payloads)
+	})
+
+	t.Run("SUCCESS TIME WINDOW & LIMIT Query", func(t *testing.T) {
+		entries, err := ListResults(f, ResultQuery{Code: "partner", To: time.Now().Add(-time.Hour)})
+		assert.NoError(t, err)
+		assert.Empty(t, entries)
+
+		entries, err = ListResults(f, ResultQuery{Code: "partner", Limit: 1})
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("SUCCESS STOP Query", func(t *testing.T) {
+		calls := 0
+		err := f.Query(ResultQuery{Code: "partner"}, func(entry ResultEntry, payload io.Reader) error {
+			calls++
+			return ErrStopQuery
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("ERROR CODE Query", func(t *testing.T) {
+		_, err := ListResults(f, ResultQuery{})
+		assert.Error(t, err)
+		_, err = ListResults(f, ResultQuery{Code: "../partner"})
+		assert.Error(t, err)
+	})
+}
+
+func TestRedisResultLogger_Query(t *testing.T) {
+	s, client := newTestRedis(t)
+	defer s.Close()
+
+	rl := NewRedisResultLogger(client, "query", time.Hour)
+	first := rl.Store("partner", []byte(`{"order":"SO-1"}`))
+	second := rl.Store("partner", []byte(`{"order":"SO-2"}`))
+
+	t.Run("SUCCESS LIST Query", func(t *testing.T) {
+		entries, err := ListResults(rl, ResultQuery{Code: "partner"})
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 2) {
+			assert.Equal(t, first, entries[0].ID)
+			assert.Equal(t, second, entries[1].ID)
+		}
+	})
+
+	t.Run("SUCCESS CONTAINS Query", func(t *testing.T) {
+		entries, err := ListResults(rl, ResultQuery{Code: "partner", Contains: "SO-1"})
+		assert.NoError(t, err)
+		if assert.Len(t, entries, 1) {
+			assert.Equal(t, `{"order":"SO-1"}`, rl.Get(entries[0].ID))
+		}
+	})
+
+	t.Run("SUCCESS EXPIRED Query", func(t *testing.T) {
+		s.Del(first)
+		entries, err := ListResults(rl, ResultQuery{Code: "partner"})
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+}
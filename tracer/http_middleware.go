@@ -29,13 +29,16 @@ func Middleware(h http.Handler) http.Handler {
 			ext.SpanKindRPCClient.Set(span)
 		}
 
+		if requestID := req.Header.Get("X-Request-ID"); requestID != "" {
+			ctx = golib.WithRequestID(ctx, requestID)
+		}
+
+		redactor := golib.DefaultRedactor()
 		body, _ := ioutil.ReadAll(req.Body)
-		bodyString := golib.MaskPassword(string(body))
-		bodyString = string(golib.MaskJSONPassword(body))
-		span.SetTag("body", bodyString)
+		span.SetTag("body", string(redactor.RedactPayload(body)))
 		req.Body = ioutil.NopCloser(bytes.NewBuffer(body)) // reuse body
 
-		span.SetTag("http.headers", req.Header)
+		span.SetTag("http.headers", redactor.RedactHeaders(req.Header))
 		ext.HTTPUrl.Set(span, req.Host+req.RequestURI)
 		ext.HTTPMethod.Set(span, req.Method)
 
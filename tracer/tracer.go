@@ -3,12 +3,11 @@ package tracer
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"runtime/debug"
 	"strconv"
-	"strings"
 
+	"github.com/Bhinneka/golib"
 	opentracing "github.com/opentracing/opentracing-go"
 	ext "github.com/opentracing/opentracing-go/ext"
 )
@@ -151,18 +150,7 @@ func toString(v interface{}) (s string) {
 
 // GetTraceID func
 func GetTraceID(ctx context.Context) string {
-	span := opentracing.SpanFromContext(ctx)
-	if span == nil {
-		return ""
-	}
-
-	traceID := fmt.Sprintf("%+v", span)
-	splits := strings.Split(traceID, ":")
-	if len(splits) > 0 {
-		return splits[0]
-	}
-
-	return traceID
+	return golib.TraceIDFromContext(ctx)
 }
 
 // SetError func